@@ -0,0 +1,232 @@
+package transformer
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/sburnett/transformer/store"
+)
+
+// The number of bytes of aggregates a hash aggregate transformer keeps in
+// memory, unless it sets the MemoryBudget option.
+const defaultMemoryBudget = 128 << 20
+
+// A rough estimate of the memory Go uses for each entry in a map of
+// aggregates, besides the key and value themselves.
+const aggregateOverheadBytes = 64
+
+// Return the key by which to aggregate a record and the value to aggregate,
+// or a nil key to ignore the record.
+type AggregateKeyFunc func(record *store.Record) (key, value []byte)
+
+// Combine two values (or partial aggregates) for the same key into one.
+// Combine must be associative and commutative, because we combine values in
+// whatever order the workers see them.
+type CombineFunc func(key, a, b []byte) []byte
+
+// Keep at most this many bytes of aggregates in memory, spilling the rest to
+// disk. Only applies to MakeHashAggregateTransformer.
+func MemoryBudget(bytes int) Option {
+	return func(options *transformerOptions) {
+		options.memoryBudget = bytes
+	}
+}
+
+// Spill to files in this directory instead of the system's temporary
+// directory. Only applies to MakeHashAggregateTransformer.
+func TempDir(dir string) Option {
+	return func(options *transformerOptions) {
+		options.tempDir = dir
+	}
+}
+
+type hashAggregateTransformer struct {
+	keyFunc     AggregateKeyFunc
+	combineFunc CombineFunc
+	options     transformerOptions
+	spillErr    *aggregateError
+}
+
+// The error that stopped us from spilling or merging aggregates, if any.
+type aggregateError struct {
+	lock sync.Mutex
+	err  error
+}
+
+func (spillErr *aggregateError) set(err error) {
+	spillErr.lock.Lock()
+	defer spillErr.lock.Unlock()
+	spillErr.err = err
+}
+
+func (spillErr *aggregateError) get() error {
+	spillErr.lock.Lock()
+	defer spillErr.lock.Unlock()
+	return spillErr.err
+}
+
+// Make a Transformer that aggregates records by a key computed from each
+// record, such as a field that isn't a prefix of the record's key, so unlike
+// MakeGroupDoTransformer the input needn't be sorted by that key. We emit one
+// record per aggregation key, in key order, whose value combines the values
+// keyFunc returned for every record with that key.
+//
+// Each worker aggregates its records in its own in-memory map. When a
+// worker's map outgrows its share of the MemoryBudget option, we write its
+// partial aggregates to a store.SortingWriter, which spills them to disk in
+// sorted runs under the TempDir option. At the end we merge the runs and
+// combine the partial aggregates for each key. If spilling or merging fails,
+// we stop emitting aggregates and TryRunTransformer returns the error.
+func MakeHashAggregateTransformer(keyFunc AggregateKeyFunc, combineFunc CombineFunc, options ...Option) Transformer {
+	return hashAggregateTransformer{keyFunc, combineFunc, makeOptions(options), &aggregateError{}}
+}
+
+func (transformer hashAggregateTransformer) Do(inputChan, outputChan chan *store.Record) {
+	transformer.aggregate(func(aggregateRecord func(*store.Record)) {
+		for record := range inputChan {
+			aggregateRecord(record)
+		}
+	}, func(record *store.Record) {
+		outputChan <- record
+	})
+}
+
+func (transformer hashAggregateTransformer) failure() error {
+	if err := transformer.options.deadLetters.failure(); err != nil {
+		return err
+	}
+	return transformer.spillErr.get()
+}
+
+func (transformer hashAggregateTransformer) DoBatches(inputChan, outputChan chan []*store.Record) {
+	recordsChan := make(chan *store.Record)
+	batchesDone := make(chan bool)
+	go func() {
+		batchRecords(recordsChan, outputChan)
+		batchesDone <- true
+	}()
+	transformer.aggregate(func(aggregateRecord func(*store.Record)) {
+		for batch := range inputChan {
+			for _, record := range batch {
+				aggregateRecord(record)
+			}
+		}
+	}, func(record *store.Record) {
+		recordsChan <- record
+	})
+	close(recordsChan)
+	<-batchesDone
+}
+
+// Run the workers, each of which calls read to aggregate its share of the
+// input, then merge their aggregates and pass them to emit in key order.
+func (transformer hashAggregateTransformer) aggregate(read func(func(*store.Record)), emit func(*store.Record)) {
+	deadLetters := transformer.options.deadLetters
+	deadLetters.begin()
+	defer deadLetters.end()
+	transformer.spillErr.set(nil)
+
+	workers := transformer.options.numWorkers()
+	memoryBudget := transformer.options.memoryBudget
+	if memoryBudget <= 0 {
+		memoryBudget = defaultMemoryBudget
+	}
+	// Half the budget is for the workers' maps, and the other half is for
+	// the SortingWriter's buffer.
+	workerBudget := memoryBudget / 2 / workers
+	sorterBudget := memoryBudget / 2
+	if sorterBudget < 1 {
+		sorterBudget = 1
+	}
+
+	merger := &aggregateMerger{combineFunc: transformer.combineFunc, emit: emit}
+	sorter := store.NewSortingWriter(merger, transformer.options.tempDir, sorterBudget)
+	sorter.BeginWriting()
+	var sorterLock sync.Mutex
+	var sorterErr error
+	flush := func(aggregates map[string][]byte) {
+		sorterLock.Lock()
+		defer sorterLock.Unlock()
+		for key, value := range aggregates {
+			if sorterErr != nil {
+				return
+			}
+			sorterErr = sorter.WriteRecord(&store.Record{Key: []byte(key), Value: value})
+		}
+	}
+
+	doneChan := make(chan bool)
+	for i := 0; i < workers; i++ {
+		go func() {
+			aggregates := make(map[string][]byte)
+			var aggregateBytes int
+			read(func(record *store.Record) {
+				deadLetters.protect([]*store.Record{record}, func() {
+					key, value := transformer.keyFunc(record)
+					if key == nil {
+						return
+					}
+					if aggregate, ok := aggregates[string(key)]; ok {
+						combined := transformer.combineFunc(key, aggregate, value)
+						aggregateBytes += len(combined) - len(aggregate)
+						aggregates[string(key)] = combined
+					} else {
+						aggregates[string(key)] = append([]byte(nil), value...)
+						aggregateBytes += len(key) + len(value) + aggregateOverheadBytes
+					}
+				})
+				if aggregateBytes >= workerBudget {
+					flush(aggregates)
+					aggregates = make(map[string][]byte)
+					aggregateBytes = 0
+				}
+			})
+			flush(aggregates)
+			doneChan <- true
+		}()
+	}
+	for i := 0; i < workers; i++ {
+		<-doneChan
+	}
+	if sorterErr != nil {
+		// Still end writing so the sorter deletes its runs, but don't emit
+		// partial aggregates.
+		transformer.spillErr.set(sorterErr)
+		merger.emit = func(*store.Record) {}
+	}
+	if err := sorter.EndWriting(); err != nil && sorterErr == nil {
+		transformer.spillErr.set(err)
+	}
+}
+
+// Combines the sorted partial aggregates for each key into a single record.
+type aggregateMerger struct {
+	combineFunc CombineFunc
+	emit        func(*store.Record)
+	current     *store.Record
+}
+
+func (merger *aggregateMerger) BeginWriting() error {
+	merger.current = nil
+	return nil
+}
+
+func (merger *aggregateMerger) WriteRecord(record *store.Record) error {
+	if merger.current != nil && bytes.Equal(merger.current.Key, record.Key) {
+		merger.current.Value = merger.combineFunc(record.Key, merger.current.Value, record.Value)
+		return nil
+	}
+	if merger.current != nil {
+		merger.emit(merger.current)
+	}
+	merger.current = record
+	return nil
+}
+
+func (merger *aggregateMerger) EndWriting() error {
+	if merger.current != nil {
+		merger.emit(merger.current)
+		merger.current = nil
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package transformer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sburnett/transformer/store"
+)
+
+func ExampleMakeHashAggregateTransformer() {
+	// Records are keyed by "<device>,<day>" with a byte count as the
+	// value. Total the bytes for each day.
+	reader := &store.SliceStore{}
+	reader.BeginWriting()
+	reader.WriteRecord(store.NewRecord("device1,monday", "10", 0))
+	reader.WriteRecord(store.NewRecord("device1,tuesday", "20", 0))
+	reader.WriteRecord(store.NewRecord("device2,monday", "30", 0))
+	reader.WriteRecord(store.NewRecord("device2,tuesday", "40", 0))
+	reader.WriteRecord(store.NewRecord("device3,monday", "50", 0))
+	reader.EndWriting()
+
+	keyFunc := func(record *store.Record) ([]byte, []byte) {
+		fields := strings.Split(string(record.Key), ",")
+		return []byte(fields[1]), record.Value
+	}
+	combineFunc := func(key, a, b []byte) []byte {
+		x, _ := strconv.Atoi(string(a))
+		y, _ := strconv.Atoi(string(b))
+		return []byte(strconv.Itoa(x + y))
+	}
+	aggregate := func(options ...Option) error {
+		writer := &store.SliceStore{}
+		if err := TryRunTransformer(MakeHashAggregateTransformer(keyFunc, combineFunc, options...), reader, writer); err != nil {
+			return err
+		}
+		writer.BeginReading()
+		for {
+			record, _ := writer.ReadRecord()
+			if record == nil {
+				break
+			}
+			fmt.Printf("%s: %s\n", record.Key, record.Value)
+		}
+		writer.EndReading()
+		return nil
+	}
+
+	fmt.Println("In memory:")
+	if err := aggregate(); err != nil {
+		panic(err)
+	}
+
+	// A tiny budget makes us spill partial aggregates to disk.
+	tempDir, err := ioutil.TempDir("", "transformer-aggregate-test")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tempDir)
+	fmt.Println("Spilling:")
+	if err := aggregate(MemoryBudget(1), TempDir(tempDir)); err != nil {
+		panic(err)
+	}
+	remaining, _ := ioutil.ReadDir(tempDir)
+	fmt.Println("Remaining temporary files:", len(remaining))
+
+	// We report errors spilling to disk instead of emitting partial
+	// aggregates.
+	err = aggregate(MemoryBudget(1), TempDir(filepath.Join(tempDir, "missing")))
+	fmt.Println("Spilling to a missing directory fails:", err != nil)
+
+	// Output:
+	// In memory:
+	// monday: 90
+	// tuesday: 60
+	// Spilling:
+	// monday: 90
+	// tuesday: 60
+	// Remaining temporary files: 0
+	// Spilling to a missing directory fails: true
+}
@@ -0,0 +1,115 @@
+package transformer
+
+import (
+	"github.com/sburnett/transformer/store"
+)
+
+// The maximum number of records we send in each batch between readers,
+// transformers and writers.
+var recordsPerBatch = 1000
+
+// A Transformer that can also process batches of records. Sending a batch
+// over a channel costs the same as sending a single record, so this greatly
+// reduces overhead for cheap transformations. RunTransformer calls DoBatches
+// instead of Do when a Transformer implements this interface.
+//
+// The transformers returned by MakeMapTransformer, MakeDoTransformer and
+// MakeGroupDoTransformer (and the constructors built on them) implement
+// BatchTransformer, so your existing Mappers, Doers and GroupDoers process
+// batches without any changes.
+type BatchTransformer interface {
+	Transformer
+	DoBatches(inputChan, outputChan chan []*store.Record)
+}
+
+// Run transformer on batches of records, adapting it to batches if it isn't a
+// BatchTransformer.
+func doBatches(transformer Transformer, inputChan, outputChan chan []*store.Record) {
+	if batchTransformer, ok := transformer.(BatchTransformer); ok {
+		batchTransformer.DoBatches(inputChan, outputChan)
+		return
+	}
+	recordsInputChan := make(chan *store.Record)
+	recordsOutputChan := make(chan *store.Record)
+	doDone := make(chan bool)
+	go func() {
+		defer close(recordsInputChan)
+		for batch := range inputChan {
+			for _, record := range batch {
+				select {
+				case recordsInputChan <- record:
+				case <-doDone:
+					// Do returned without reading all its input, so
+					// discard the rest.
+					for range inputChan {
+					}
+					return
+				}
+			}
+		}
+	}()
+	batchesDone := make(chan bool)
+	go func() {
+		batchRecords(recordsOutputChan, outputChan)
+		batchesDone <- true
+	}()
+	transformer.Do(recordsInputChan, recordsOutputChan)
+	close(doDone)
+	close(recordsOutputChan)
+	<-batchesDone
+}
+
+// Group records from recordsChan into batches and send them on batchesChan.
+func batchRecords(recordsChan chan *store.Record, batchesChan chan []*store.Record) {
+	var batch []*store.Record
+	for record := range recordsChan {
+		batch = append(batch, record)
+		if len(batch) >= recordsPerBatch {
+			batchesChan <- batch
+			batch = nil
+		}
+	}
+	if len(batch) > 0 {
+		batchesChan <- batch
+	}
+}
+
+// Process batches from inputChan on workers goroutines and send nonempty
+// results to outputChan.
+func processBatches(inputChan, outputChan chan []*store.Record, workers int, process func([]*store.Record) []*store.Record) {
+	doneChan := make(chan bool)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for batch := range inputChan {
+				if outputs := process(batch); len(outputs) > 0 {
+					outputChan <- outputs
+				}
+			}
+			doneChan <- true
+		}()
+	}
+	for i := 0; i < workers; i++ {
+		<-doneChan
+	}
+}
+
+// Call emit with a channel and return every record it sends on that channel.
+// This lets us call Doers and GroupDoers, which send their outputs on a
+// channel, from batch-oriented code. If emit panics, we stop collecting and
+// let the panic continue.
+func collectRecords(emit func(chan *store.Record)) []*store.Record {
+	recordsChan := make(chan *store.Record, 64)
+	collectedChan := make(chan []*store.Record, 1)
+	go func() {
+		var records []*store.Record
+		for record := range recordsChan {
+			records = append(records, record)
+		}
+		collectedChan <- records
+	}()
+	func() {
+		defer close(recordsChan)
+		emit(recordsChan)
+	}()
+	return <-collectedChan
+}
@@ -0,0 +1,53 @@
+package transformer
+
+import (
+	"fmt"
+
+	"github.com/sburnett/transformer/store"
+)
+
+func ExampleBatchTransformer() {
+	savedRecordsPerBatch := recordsPerBatch
+	recordsPerBatch = 2
+	defer func() { recordsPerBatch = savedRecordsPerBatch }()
+
+	reader := store.NewDemuxingReader(&store.SliceStore{}, &store.SliceStore{}, &store.SliceStore{})
+	for idx, stores := range reader.WrappedStores() {
+		writer := stores.(*store.SliceStore)
+		writer.BeginWriting()
+		for _, key := range []string{"a", "b", "c"} {
+			writer.WriteRecord(store.NewRecord(key, fmt.Sprint(idx), 0))
+		}
+		writer.EndWriting()
+	}
+
+	// Groups have three records, so they span batches.
+	transformer := MakeGroupDoFunc(func(inputRecords []*store.Record, outputChan chan *store.Record) {
+		var value []byte
+		for _, record := range inputRecords {
+			value = append(value, record.Value...)
+		}
+		outputChan <- &store.Record{Key: inputRecords[0].Key, Value: value}
+	})
+	if _, ok := transformer.(BatchTransformer); !ok {
+		panic("not a BatchTransformer")
+	}
+
+	writer := &store.SliceStore{}
+	RunTransformer(transformer, reader, writer)
+
+	writer.BeginReading()
+	for {
+		record, _ := writer.ReadRecord()
+		if record == nil {
+			break
+		}
+		fmt.Printf("%s: %s\n", record.Key, record.Value)
+	}
+	writer.EndReading()
+
+	// Output:
+	// a: 012
+	// b: 012
+	// c: 012
+}
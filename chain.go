@@ -0,0 +1,102 @@
+package transformer
+
+import (
+	"github.com/sburnett/transformer/store"
+)
+
+type chainedTransformer []Transformer
+
+// Compose several transformers into one, so you can apply them in a single
+// PipelineStage. Records stream from each transformer to the next over
+// channels in memory rather than through intermediate stores. Each
+// transformer runs concurrently with the others and keeps its own
+// parallelism, so, for example, chaining two Mappers still maps records on
+// every worker. Chained transformers that use side inputs, like those from
+// MakeSideInputMapFunc, get the stage's side inputs.
+func Chain(transformers ...Transformer) Transformer {
+	return chainedTransformer(transformers)
+}
+
+func (transformers chainedTransformer) Do(inputChan, outputChan chan *store.Record) {
+	doneChan := make(chan bool)
+	for idx, transformer := range transformers {
+		nextChan := outputChan
+		if idx < len(transformers)-1 {
+			nextChan = make(chan *store.Record)
+		}
+		go func(transformer Transformer, inputChan, outputChan chan *store.Record, first, last bool) {
+			transformer.Do(inputChan, outputChan)
+			if !last {
+				close(outputChan)
+			}
+			if !first {
+				// Let the previous transformer finish even if this one
+				// returned without reading all its input.
+				for range inputChan {
+				}
+			}
+			doneChan <- true
+		}(transformer, inputChan, nextChan, idx == 0, idx == len(transformers)-1)
+		inputChan = nextChan
+	}
+	if len(transformers) == 0 {
+		for record := range inputChan {
+			outputChan <- record
+		}
+	}
+	for range transformers {
+		<-doneChan
+	}
+}
+
+// Give side inputs to the chained transformers that use them.
+func (transformers chainedTransformer) withSideInputs(sideInputs SideInputs) Transformer {
+	withSideInputs := make(chainedTransformer, len(transformers))
+	for idx, transformer := range transformers {
+		if user, ok := transformer.(sideInputUser); ok {
+			transformer = user.withSideInputs(sideInputs)
+		}
+		withSideInputs[idx] = transformer
+	}
+	return withSideInputs
+}
+
+// Report the first failure of any of the chained transformers.
+func (transformers chainedTransformer) failure() error {
+	for _, transformer := range transformers {
+		if err := transformerFailure(transformer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (transformers chainedTransformer) DoBatches(inputChan, outputChan chan []*store.Record) {
+	doneChan := make(chan bool)
+	for idx, transformer := range transformers {
+		nextChan := outputChan
+		if idx < len(transformers)-1 {
+			nextChan = make(chan []*store.Record)
+		}
+		go func(transformer Transformer, inputChan, outputChan chan []*store.Record, first, last bool) {
+			doBatches(transformer, inputChan, outputChan)
+			if !last {
+				close(outputChan)
+			}
+			if !first {
+				for range inputChan {
+				}
+			}
+			doneChan <- true
+		}(transformer, inputChan, nextChan, idx == 0, idx == len(transformers)-1)
+		inputChan = nextChan
+	}
+	if len(transformers) == 0 {
+		for batch := range inputChan {
+			outputChan <- batch
+		}
+	}
+	for range transformers {
+		<-doneChan
+	}
+}
@@ -0,0 +1,116 @@
+package transformer
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/sburnett/transformer/store"
+)
+
+func ExampleChain() {
+	double := MakeMapFunc(func(record *store.Record) *store.Record {
+		return &store.Record{
+			Key:   record.Key,
+			Value: bytes.Repeat(record.Value, 2),
+		}
+	})
+	dropB := MakeDoFunc(func(record *store.Record, outputChan chan *store.Record) {
+		if string(record.Key) != "b" {
+			outputChan <- record
+		}
+	})
+	transformer := Chain(double, dropB, double)
+
+	reader := &store.SliceStore{}
+	reader.BeginWriting()
+	for _, key := range []string{"a", "b", "c"} {
+		reader.WriteRecord(store.NewRecord(key, "x", 0))
+	}
+	reader.EndWriting()
+
+	writer := &store.SliceStore{}
+	RunTransformer(transformer, reader, writer)
+
+	writer.BeginReading()
+	for {
+		record, _ := writer.ReadRecord()
+		if record == nil {
+			break
+		}
+		fmt.Printf("%s: %s\n", record.Key, record.Value)
+	}
+	writer.EndReading()
+
+	// Output:
+	// a: xxxx
+	// c: xxxx
+}
+
+func ExampleChain_records() {
+	upper := MakeMapFunc(func(record *store.Record) *store.Record {
+		return &store.Record{Key: bytes.ToUpper(record.Key)}
+	})
+	transformer := Chain(upper, upper)
+
+	inputChan := make(chan *store.Record, 2)
+	inputChan <- store.NewRecord("a", "", 0)
+	inputChan <- store.NewRecord("b", "", 0)
+	close(inputChan)
+	outputChan := make(chan *store.Record, 2)
+	transformer.Do(inputChan, outputChan)
+	close(outputChan)
+
+	for record := range outputChan {
+		fmt.Printf("%s\n", record.Key)
+	}
+
+	// Output:
+	// A
+	// B
+}
+
+func ExampleChain_returnEarly() {
+	upper := MakeMapFunc(func(record *store.Record) *store.Record {
+		return &store.Record{Key: bytes.ToUpper(record.Key)}
+	})
+	// Returns after the first record, without reading the rest.
+	first := TransformFunc(func(inputChan, outputChan chan *store.Record) {
+		outputChan <- <-inputChan
+	})
+
+	reader := &store.SliceStore{}
+	reader.BeginWriting()
+	for i := 0; i < 5000; i++ {
+		reader.WriteRecord(store.NewRecord(fmt.Sprintf("a%04d", i), "", 0))
+	}
+	reader.EndWriting()
+	writer := &store.SliceStore{}
+	if err := TryRunTransformer(Chain(upper, first), reader, writer); err != nil {
+		panic(err)
+	}
+	writer.BeginReading()
+	for {
+		record, _ := writer.ReadRecord()
+		if record == nil {
+			break
+		}
+		fmt.Printf("%s\n", record.Key)
+	}
+	writer.EndReading()
+
+	inputChan := make(chan *store.Record, 3)
+	for _, key := range []string{"b", "c", "d"} {
+		inputChan <- store.NewRecord(key, "", 0)
+	}
+	close(inputChan)
+	outputChan := make(chan *store.Record, 3)
+	Chain(upper, first).Do(inputChan, outputChan)
+	close(outputChan)
+	for record := range outputChan {
+		fmt.Printf("%s\n", record.Key)
+	}
+
+	// Output:
+	// A0000
+	// B
+}
@@ -0,0 +1,108 @@
+package transformer
+
+import (
+	"os"
+	"time"
+
+	"github.com/sburnett/transformer/store"
+)
+
+// Decide whether to run a stage. We evaluate a stage's Condition once the
+// stages it depends on have completed, just before we would run it. No running
+// stage reads or writes the same stores then, so conditions may open them.
+type StageCondition func(stage PipelineStage) (bool, error)
+
+// Run the stage only if its Reader has at least one record. Stores that don't
+// exist yet have no records. If only some of the Reader's stores exist, we
+// can't open the Reader, so we check each existing store on its own, ignoring
+// wrappers like store.RangeIncludingReader.
+func InputNotEmpty(stage PipelineStage) (bool, error) {
+	if stage.Reader == nil {
+		return false, nil
+	}
+	leaves := store.Leaves(stage.Reader)
+	existing := existingStores(leaves)
+	if len(existing) == len(leaves) {
+		return hasRecords(stage.Reader)
+	}
+	for _, leaf := range existing {
+		reader, ok := leaf.(store.Reader)
+		if !ok {
+			return true, nil
+		}
+		if notEmpty, err := hasRecords(reader); err != nil || notEmpty {
+			return notEmpty, err
+		}
+	}
+	return false, nil
+}
+
+// Report whether reader has at least one record.
+func hasRecords(reader store.Reader) (bool, error) {
+	if err := reader.BeginReading(); err != nil {
+		return false, &StoreError{Op: "BeginReading", Store: reader, Err: err}
+	}
+	record, readErr := reader.ReadRecord()
+	if err := reader.EndReading(); err != nil {
+		return false, &StoreError{Op: "EndReading", Store: reader, Err: err}
+	}
+	if readErr != nil {
+		return false, &StoreError{Op: "ReadRecord", Store: reader, Err: readErr}
+	}
+	return record != nil, nil
+}
+
+// Return the stores that exist, without opening them, since opening a
+// missing LevelDB would create it. We assume stores that don't implement
+// store.ModTimer exist.
+func existingStores(stores []interface{}) []interface{} {
+	var existing []interface{}
+	for _, s := range stores {
+		if modTimer, ok := s.(store.ModTimer); ok {
+			if _, err := modTimer.ModTime(); os.IsNotExist(err) {
+				continue
+			}
+		}
+		existing = append(existing, s)
+	}
+	return existing
+}
+
+// Run the stage only if some store it reads changed after the last change to
+// the stores it writes, like make. We run the stage if it writes a store that
+// doesn't exist yet, or if we can't tell when a store changed because it
+// doesn't implement store.ModTimer.
+func OutputOlderThanInputs(stage PipelineStage) (bool, error) {
+	newestInput, ok, err := modTime(stage.Reader, time.Time.After)
+	if err != nil || !ok {
+		return true, err
+	}
+	oldestOutput, ok, err := modTime(stage.Writer, time.Time.Before)
+	if err != nil || !ok {
+		return true, err
+	}
+	return newestInput.After(oldestOutput), nil
+}
+
+// Return the modification time of the store in s that pick prefers (i.e.,
+// the newest or oldest store). The boolean is false if we can't tell when
+// some store changed or it doesn't exist.
+func modTime(s interface{}, pick func(a, b time.Time) bool) (time.Time, bool, error) {
+	var picked time.Time
+	for idx, leaf := range store.Leaves(s) {
+		modTimer, ok := leaf.(store.ModTimer)
+		if !ok {
+			return time.Time{}, false, nil
+		}
+		leafModTime, err := modTimer.ModTime()
+		if os.IsNotExist(err) {
+			return time.Time{}, false, nil
+		} else if err != nil {
+			return time.Time{}, false, err
+		}
+		if idx == 0 || pick(leafModTime, picked) {
+			picked = leafModTime
+		}
+	}
+	return picked, true, nil
+}
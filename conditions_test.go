@@ -0,0 +1,119 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sburnett/transformer/store"
+)
+
+func ExampleInputNotEmpty() {
+	full := &store.SliceStore{}
+	full.BeginWriting()
+	full.WriteRecord(store.NewRecord("a", "x", 0))
+	full.EndWriting()
+
+	copyRecords := TransformFunc(func(inputChan, outputChan chan *store.Record) {
+		fmt.Println("Copying")
+		for record := range inputChan {
+			outputChan <- record
+		}
+	})
+	pipeline := Pipeline{
+		{
+			Name:        "CopyEmpty",
+			Transformer: copyRecords,
+			Reader:      &store.SliceStore{},
+			Writer:      &store.SliceStore{},
+			Condition:   InputNotEmpty,
+		},
+		{
+			Name:        "CopyFull",
+			Transformer: copyRecords,
+			Reader:      full,
+			Writer:      &store.SliceStore{},
+			Condition:   InputNotEmpty,
+		},
+	}
+	if err := RunPipelineContext(context.Background(), pipeline); err != nil {
+		panic(err)
+	}
+
+	// A LevelDB that doesn't exist yet has no records.
+	dbRoot, err := ioutil.TempDir("", "transformer-conditions-test")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dbRoot)
+	manager := store.NewLevelDbManager(dbRoot)
+	run, err := InputNotEmpty(PipelineStage{Reader: manager.Reader("missing")})
+	fmt.Println("Run when input is missing:", run, err)
+
+	// Only some of the stores a Reader combines may exist.
+	for _, name := range []string{"empty", "full"} {
+		writer := manager.Writer(name)
+		writer.BeginWriting()
+		if name == "full" {
+			writer.WriteRecord(store.NewRecord("a", "x", 0))
+		}
+		writer.EndWriting()
+	}
+	run, err = InputNotEmpty(PipelineStage{Reader: store.NewDemuxingReader(manager.Reader("missing"), manager.Reader("empty"))})
+	fmt.Println("Run when input is partly missing and empty:", run, err)
+	run, err = InputNotEmpty(PipelineStage{Reader: store.NewDemuxingReader(manager.Reader("missing"), manager.Reader("full"))})
+	fmt.Println("Run when input is partly missing and full:", run, err)
+
+	// Output:
+	// Copying
+	// Run when input is missing: false <nil>
+	// Run when input is partly missing and empty: false <nil>
+	// Run when input is partly missing and full: true <nil>
+}
+
+func ExampleOutputOlderThanInputs() {
+	dbRoot, err := ioutil.TempDir("", "transformer-conditions-test")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dbRoot)
+	manager := store.NewLevelDbManager(dbRoot)
+
+	write := func(name string) {
+		writer := manager.Writer(name)
+		writer.BeginWriting()
+		writer.WriteRecord(store.NewRecord("a", "x", 0))
+		writer.EndWriting()
+	}
+	setModTime := func(name string, modTime time.Time) {
+		files, _ := filepath.Glob(filepath.Join(dbRoot, name, "*"))
+		for _, file := range files {
+			os.Chtimes(file, modTime, modTime)
+		}
+	}
+
+	stage := PipelineStage{
+		Reader: manager.Reader("input"),
+		Writer: manager.Writer("output"),
+	}
+	write("input")
+	run, _ := OutputOlderThanInputs(stage)
+	fmt.Println("Run when output is missing:", run)
+
+	write("output")
+	setModTime("input", time.Now().Add(-time.Hour))
+	run, _ = OutputOlderThanInputs(stage)
+	fmt.Println("Run when output is newer:", run)
+
+	setModTime("input", time.Now().Add(time.Hour))
+	run, _ = OutputOlderThanInputs(stage)
+	fmt.Println("Run when input is newer:", run)
+
+	// Output:
+	// Run when output is missing: true
+	// Run when output is newer: false
+	// Run when input is newer: true
+}
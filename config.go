@@ -0,0 +1,304 @@
+package transformer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sburnett/transformer/store"
+)
+
+// Make a Transformer from the parameters of a stage in a pipeline config file.
+// params is the raw JSON of the stage's "params" field, or nil if the stage
+// has no parameters; unmarshal it into whatever type your transformer needs.
+type TransformerFactory func(params json.RawMessage) (Transformer, error)
+
+// Make a store.Manager rooted at root, which is usually a directory or a
+// database filename.
+type ManagerFactory func(root string) store.Manager
+
+var registryLock sync.Mutex
+var transformerFactories = map[string]TransformerFactory{}
+var managerFactories = map[string]ManagerFactory{
+	"leveldb": store.NewLevelDbManager,
+	"memory": func(root string) store.Manager {
+		return store.NewSliceManager()
+	},
+}
+
+// Make a transformer available to pipeline config files under name. Call this
+// from an init function or before calling LoadPipeline.
+func RegisterTransformer(name string, factory TransformerFactory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, ok := transformerFactories[name]; ok {
+		panic(fmt.Errorf("Transformer %q registered twice", name))
+	}
+	transformerFactories[name] = factory
+}
+
+// Make a kind of store available to pipeline config files under name. We
+// register "leveldb" (store.NewLevelDbManager) and "memory"
+// (store.NewSliceManager) for you. Stores like CSV files and Sqlite tables
+// need typed column parameters that JSON can't express, so register your own
+// Manager for those.
+func RegisterManager(name string, factory ManagerFactory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, ok := managerFactories[name]; ok {
+		panic(fmt.Errorf("Manager %q registered twice", name))
+	}
+	managerFactories[name] = factory
+}
+
+// The contents of a pipeline config file. For example:
+//
+//	{
+//	  "managers": {
+//	    "db": {"type": "leveldb", "root": "/data/leveldbs"}
+//	  },
+//	  "stages": [
+//	    {
+//	      "name": "ParseTraces",
+//	      "transformer": "parse_traces",
+//	      "params": {"min_size": 10},
+//	      "inputs": [{"manager": "db", "params": ["raw_traces"]}],
+//	      "outputs": [{"manager": "db", "params": ["traces"]}]
+//	    }
+//	  ]
+//	}
+//
+// A stage with several inputs reads them through a store.DemuxingReader and a
+// stage with several outputs writes them through a store.MuxingWriter. A stage
+// without outputs has no Writer, e.g., because it only validates its input.
+type PipelineConfig struct {
+	Managers map[string]ManagerConfig `json:"managers"`
+	Stages   []StageConfig            `json:"stages"`
+}
+
+// A Manager in a pipeline config file. Type is the name of a registered
+// ManagerFactory.
+type ManagerConfig struct {
+	Type string `json:"type"`
+	Root string `json:"root"`
+}
+
+// A stage in a pipeline config file. Transformer is the name of a registered
+// TransformerFactory, which gets Params.
+type StageConfig struct {
+	Name        string                 `json:"name"`
+	Transformer string                 `json:"transformer"`
+	Params      json.RawMessage        `json:"params"`
+	Version     string                 `json:"version"`
+	Inputs      []StoreConfig          `json:"inputs"`
+	Outputs     []StoreConfig          `json:"outputs"`
+	SideInputs  map[string]StoreConfig `json:"side_inputs"`
+	DependsOn   []string               `json:"depends_on"`
+}
+
+// A store in a pipeline config file. We pass Params to the Reader or Writer
+// method of the named Manager.
+type StoreConfig struct {
+	Manager string        `json:"manager"`
+	Params  []interface{} `json:"params"`
+}
+
+// Read a pipeline config file and assemble the Pipeline it describes.
+func LoadPipeline(filename string) (Pipeline, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	pipeline, err := ReadPipeline(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return pipeline, nil
+}
+
+// Read a pipeline config from reader and assemble the Pipeline it describes.
+func ReadPipeline(reader io.Reader) (Pipeline, error) {
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+	var config PipelineConfig
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("Error parsing pipeline config: %v", err)
+	}
+	return config.Pipeline()
+}
+
+// Assemble the Pipeline described by the config. Errors about a particular
+// stage are StageErrors naming that stage, or its position in the config if it
+// has no name.
+func (config PipelineConfig) Pipeline() (Pipeline, error) {
+	var managerNames []string
+	for name := range config.Managers {
+		managerNames = append(managerNames, name)
+	}
+	sort.Strings(managerNames)
+	managers := make(map[string]store.Manager)
+	for _, name := range managerNames {
+		managerConfig := config.Managers[name]
+		factory, ok := lookupManagerFactory(managerConfig.Type)
+		if !ok {
+			return nil, fmt.Errorf("manager %s: unknown type %q (registered types: %s)", name, managerConfig.Type, managerTypes())
+		}
+		managers[name] = factory(managerConfig.Root)
+	}
+
+	var pipeline Pipeline
+	seenStages := make(map[string]bool)
+	for idx, stageConfig := range config.Stages {
+		stage, err := stageConfig.stage(managers, seenStages)
+		if err != nil {
+			stageName := stageConfig.Name
+			if stageName == "" {
+				stageName = fmt.Sprintf("#%d", idx+1)
+			}
+			return nil, &StageError{Stage: stageName, Err: err}
+		}
+		seenStages[stage.Name] = true
+		pipeline = append(pipeline, stage)
+	}
+	return pipeline, nil
+}
+
+func (config StageConfig) stage(managers map[string]store.Manager, earlierStages map[string]bool) (PipelineStage, error) {
+	stage := PipelineStage{
+		Name:      config.Name,
+		Version:   config.Version,
+		DependsOn: config.DependsOn,
+	}
+	if config.Name == "" {
+		return stage, fmt.Errorf("missing name")
+	}
+	if earlierStages[config.Name] {
+		return stage, fmt.Errorf("duplicate stage name")
+	}
+	for _, dependency := range config.DependsOn {
+		if !earlierStages[dependency] {
+			return stage, fmt.Errorf("depends on %q, which isn't an earlier stage", dependency)
+		}
+	}
+
+	if config.Transformer == "" {
+		return stage, fmt.Errorf("missing transformer")
+	}
+	factory, ok := lookupTransformerFactory(config.Transformer)
+	if !ok {
+		return stage, fmt.Errorf("unknown transformer %q (registered transformers: %s)", config.Transformer, transformerNames())
+	}
+	transformer, err := factory(config.Params)
+	if err != nil {
+		return stage, fmt.Errorf("transformer %s: %v", config.Transformer, err)
+	}
+	stage.Transformer = transformer
+
+	var readers []store.Reader
+	for idx, input := range config.Inputs {
+		var reader store.Reader
+		err := input.open(managers, func(manager store.Manager) {
+			reader = manager.Reader(input.Params...)
+		})
+		if err != nil {
+			return stage, fmt.Errorf("input %d: %v", idx+1, err)
+		}
+		readers = append(readers, reader)
+	}
+	if len(readers) == 1 {
+		stage.Reader = readers[0]
+	} else if len(readers) > 1 {
+		stage.Reader = store.NewDemuxingReader(readers...)
+	}
+
+	for name, sideInput := range config.SideInputs {
+		var reader store.Reader
+		err := sideInput.open(managers, func(manager store.Manager) {
+			reader = manager.Reader(sideInput.Params...)
+		})
+		if err != nil {
+			return stage, fmt.Errorf("side input %s: %v", name, err)
+		}
+		if stage.SideInputs == nil {
+			stage.SideInputs = make(map[string]store.Reader)
+		}
+		stage.SideInputs[name] = reader
+	}
+
+	var writers []store.Writer
+	for idx, output := range config.Outputs {
+		var writer store.Writer
+		err := output.open(managers, func(manager store.Manager) {
+			writer = manager.Writer(output.Params...)
+		})
+		if err != nil {
+			return stage, fmt.Errorf("output %d: %v", idx+1, err)
+		}
+		writers = append(writers, writer)
+	}
+	if len(writers) == 1 {
+		stage.Writer = writers[0]
+	} else if len(writers) > 1 {
+		stage.Writer = store.NewMuxingWriter(writers...)
+	}
+	return stage, nil
+}
+
+// Managers panic when they don't like their parameters, so we turn those
+// panics into errors.
+func (config StoreConfig) open(managers map[string]store.Manager, open func(store.Manager)) (err error) {
+	manager, ok := managers[config.Manager]
+	if !ok {
+		return fmt.Errorf("unknown manager %q", config.Manager)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("manager %s can't open %v: %v", config.Manager, config.Params, r)
+		}
+	}()
+	open(manager)
+	return nil
+}
+
+// We don't hold registryLock while calling factories, since a factory may
+// register more factories.
+func lookupTransformerFactory(name string) (TransformerFactory, bool) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	factory, ok := transformerFactories[name]
+	return factory, ok
+}
+
+func lookupManagerFactory(name string) (ManagerFactory, bool) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	factory, ok := managerFactories[name]
+	return factory, ok
+}
+
+func transformerNames() string {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	var names []string
+	for name := range transformerFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func managerTypes() string {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	var names []string
+	for name := range managerFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,154 @@
+package transformer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sburnett/transformer/store"
+)
+
+var exampleConfigStores = store.NewSliceManager()
+
+func init() {
+	RegisterTransformer("repeat", func(params json.RawMessage) (Transformer, error) {
+		var config struct{ Times int }
+		if err := json.Unmarshal(params, &config); err != nil {
+			return nil, err
+		}
+		if config.Times < 1 {
+			return nil, fmt.Errorf("Times must be positive")
+		}
+		return MakeMapFunc(func(record *store.Record) *store.Record {
+			return &store.Record{
+				Key:   record.Key,
+				Value: bytes.Repeat(record.Value, config.Times),
+			}
+		}), nil
+	})
+	RegisterManager("example", func(root string) store.Manager {
+		return exampleConfigStores
+	})
+}
+
+func ExampleReadPipeline() {
+	input := exampleConfigStores.Writer("input")
+	input.BeginWriting()
+	input.WriteRecord(store.NewRecord("a", "x", 0))
+	input.WriteRecord(store.NewRecord("b", "y", 0))
+	input.EndWriting()
+
+	pipeline, err := ReadPipeline(strings.NewReader(`{
+		"managers": {"slices": {"type": "example"}},
+		"stages": [
+			{
+				"name": "Repeat",
+				"transformer": "repeat",
+				"params": {"times": 3},
+				"inputs": [{"manager": "slices", "params": ["input"]}],
+				"outputs": [{"manager": "slices", "params": ["output"]}]
+			},
+			{
+				"name": "Check",
+				"transformer": "repeat",
+				"params": {"times": 1},
+				"inputs": [{"manager": "slices", "params": ["output"]}]
+			}
+		]
+	}`))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("Check has a Writer:", pipeline[1].Writer != nil)
+	RunPipeline(pipeline)
+
+	output := exampleConfigStores.GetSlice("output")
+	output.BeginReading()
+	for {
+		record, _ := output.ReadRecord()
+		if record == nil {
+			break
+		}
+		fmt.Printf("%s: %s\n", record.Key, record.Value)
+	}
+	output.EndReading()
+
+	// Output:
+	// Check has a Writer: false
+	// a: xxx
+	// b: yyy
+}
+
+func ExampleReadPipeline_errors() {
+	_, err := ReadPipeline(strings.NewReader(`{
+		"managers": {"slices": {"type": "memory"}},
+		"stages": [
+			{
+				"name": "Repeat",
+				"transformer": "repeat",
+				"params": {"times": 3},
+				"outputs": [{"manager": "slices", "params": ["output"]}]
+			},
+			{
+				"name": "RepeatAgain",
+				"transformer": "repeat",
+				"params": {"times": 0},
+				"inputs": [{"manager": "slices", "params": ["output"]}],
+				"outputs": [{"manager": "slices", "params": ["again"]}]
+			}
+		]
+	}`))
+	fmt.Println(err)
+
+	_, err = ReadPipeline(strings.NewReader(`{
+		"stages": [
+			{
+				"name": "Repeat",
+				"transformer": "repeat",
+				"params": {"times": 3},
+				"outputs": [{"manager": "missing", "params": ["output"]}]
+			}
+		]
+	}`))
+	fmt.Println(err)
+
+	// Output:
+	// stage RepeatAgain: transformer repeat: Times must be positive
+	// stage Repeat: output 1: unknown manager "missing"
+}
+
+func ExampleRegisterTransformer() {
+	// Factories can register more factories, e.g., to make helpers
+	// available the first time someone uses them.
+	RegisterTransformer("register_helper", func(params json.RawMessage) (Transformer, error) {
+		RegisterTransformer("helper", func(params json.RawMessage) (Transformer, error) {
+			return MakeMapFunc(func(record *store.Record) *store.Record {
+				return record
+			}), nil
+		})
+		return MakeMapFunc(func(record *store.Record) *store.Record {
+			return record
+		}), nil
+	})
+
+	_, err := ReadPipeline(strings.NewReader(`{
+		"managers": {"slices": {"type": "memory"}},
+		"stages": [
+			{
+				"name": "Register",
+				"transformer": "register_helper",
+				"outputs": [{"manager": "slices", "params": ["registered"]}]
+			},
+			{
+				"name": "UseHelper",
+				"transformer": "helper",
+				"outputs": [{"manager": "slices", "params": ["helped"]}]
+			}
+		]
+	}`))
+	fmt.Println(err)
+
+	// Output:
+	// <nil>
+}
@@ -0,0 +1,135 @@
+package transformer
+
+import (
+	"expvar"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Assume cache lines are no longer than this, so shards on different cache
+// lines don't contend.
+const cacheLineBytes = 64
+
+type counterShard struct {
+	value int64
+	_     [cacheLineBytes - 8]byte
+}
+
+// A Counter counts events inside transformers, such as records with missing
+// fields. Make counters with NewCounter, usually as package-level variables,
+// and call Add from your Mappers, Doers and GroupDoers. We log the amount each
+// stage added to each counter when the stage completes, include it in the
+// stage's expvar statistics and print it in the run summary.
+//
+// A Counter is split into shards so workers on different CPUs can update it
+// without contending. Since we can't tell which stage called Add, a stage's
+// count is the change in the counter while it ran. We don't report counts for
+// stages that ran concurrently with other stages (see RunPipelineDAG), since
+// they could include the other stages' counts; the Counters expvar variable
+// still has the totals.
+type Counter struct {
+	name   string
+	shards []counterShard
+}
+
+var countersLock sync.Mutex
+var counters = make(map[string]*Counter)
+
+// Initialized here rather than in init so packages can make counters in
+// their variable declarations.
+var counterVars = expvar.NewMap("Counters")
+
+// Each worker gets a shard index from this pool. sync.Pool keeps a cache per
+// CPU, so concurrent workers usually get different indices. If the pool drops
+// an index we just hand out another one.
+var counterShardHints = sync.Pool{
+	New: func() interface{} {
+		hint := int(atomic.AddUint32(&nextCounterShardHint, 1))
+		return &hint
+	},
+}
+var nextCounterShardHint uint32
+
+// Make a new Counter, which we publish in the Counters expvar variable. The
+// name must be unique.
+func NewCounter(name string) *Counter {
+	countersLock.Lock()
+	defer countersLock.Unlock()
+	if _, ok := counters[name]; ok {
+		panic(fmt.Errorf("Counter %q created twice", name))
+	}
+	counter := &Counter{
+		name:   name,
+		shards: make([]counterShard, 2*runtime.GOMAXPROCS(0)),
+	}
+	counters[name] = counter
+	counterVars.Set(name, counter)
+	return counter
+}
+
+// Add delta to the counter. It's safe to call Add from many goroutines.
+func (counter *Counter) Add(delta int64) {
+	hint := counterShardHints.Get().(*int)
+	atomic.AddInt64(&counter.shards[*hint%len(counter.shards)].value, delta)
+	counterShardHints.Put(hint)
+}
+
+// The total of every call to Add.
+func (counter *Counter) Value() int64 {
+	var value int64
+	for idx := range counter.shards {
+		value += atomic.LoadInt64(&counter.shards[idx].value)
+	}
+	return value
+}
+
+// The name we publish the counter under in the Counters expvar variable.
+func (counter *Counter) Name() string {
+	return counter.name
+}
+
+// Implements expvar.Var.
+func (counter *Counter) String() string {
+	return fmt.Sprint(counter.Value())
+}
+
+// Return the current value of every counter.
+func counterValues() map[string]int64 {
+	countersLock.Lock()
+	defer countersLock.Unlock()
+	values := make(map[string]int64, len(counters))
+	for name, counter := range counters {
+		values[name] = counter.Value()
+	}
+	return values
+}
+
+// Return the counters that changed between start and end and how much they
+// changed.
+func counterDeltas(start, end map[string]int64) map[string]int64 {
+	deltas := make(map[string]int64)
+	for name, value := range end {
+		if delta := value - start[name]; delta != 0 {
+			deltas[name] = delta
+		}
+	}
+	return deltas
+}
+
+// Format counter deltas as "name=value" pairs sorted by name.
+func formatCounters(deltas map[string]int64) string {
+	var names []string
+	for name := range deltas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var pairs []string
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", name, deltas[name]))
+	}
+	return strings.Join(pairs, ", ")
+}
@@ -0,0 +1,114 @@
+package transformer
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+
+	"github.com/sburnett/transformer/store"
+)
+
+var emptyValues = NewCounter("EmptyValues")
+
+func ExampleNewCounter() {
+	reader := &store.SliceStore{}
+	reader.BeginWriting()
+	reader.WriteRecord(store.NewRecord("a", "x", 0))
+	reader.WriteRecord(store.NewRecord("b", "", 0))
+	reader.WriteRecord(store.NewRecord("c", "", 0))
+	reader.EndWriting()
+
+	pipeline := Pipeline{
+		{
+			Name: "DropEmpty",
+			Transformer: MakeMapFunc(func(record *store.Record) *store.Record {
+				if len(record.Value) == 0 {
+					emptyValues.Add(1)
+					return nil
+				}
+				return record
+			}),
+			Reader: reader,
+			Writer: &store.SliceStore{},
+		},
+	}
+	if err := RunPipelineContext(context.Background(), pipeline); err != nil {
+		panic(err)
+	}
+
+	var stats struct {
+		Counters map[string]int64
+	}
+	encoded := expvar.Get("Stages").(*expvar.Map).Get("DropEmpty").String()
+	if err := json.Unmarshal([]byte(encoded), &stats); err != nil {
+		panic(err)
+	}
+	fmt.Println("Stage counters:", stats.Counters)
+	fmt.Println("Total:", expvar.Get("Counters").(*expvar.Map).Get("EmptyValues"))
+
+	// Output:
+	// Stage counters: map[EmptyValues:2]
+	// Total: 2
+}
+
+var concurrentRecords = NewCounter("ConcurrentRecords")
+
+func ExampleNewCounter_concurrentStages() {
+	// The second stage starts while the first is still running, so both add
+	// to the counter at once.
+	secondStarted := make(chan bool)
+	countRecords := func(wait bool) Transformer {
+		return TransformFunc(func(inputChan, outputChan chan *store.Record) {
+			if wait {
+				<-secondStarted
+			} else {
+				close(secondStarted)
+			}
+			for record := range inputChan {
+				concurrentRecords.Add(1)
+				outputChan <- record
+			}
+		})
+	}
+	input := &store.SliceStore{}
+	input.BeginWriting()
+	input.WriteRecord(store.NewRecord("a", "x", 0))
+	input.EndWriting()
+	pipeline := Pipeline{
+		{
+			Name:        "CountFirst",
+			Transformer: countRecords(true),
+			Reader:      input,
+			Writer:      &store.SliceStore{},
+		},
+		{
+			Name:        "CountSecond",
+			Transformer: countRecords(false),
+			Reader:      &store.SliceStore{},
+			Writer:      &store.SliceStore{},
+		},
+	}
+	if err := RunPipelineDAG(context.Background(), pipeline, 2); err != nil {
+		panic(err)
+	}
+
+	// We can't tell which stage added to the counter, so we only report the
+	// total.
+	for _, name := range []string{"CountFirst", "CountSecond"} {
+		var stats struct {
+			Counters map[string]int64
+		}
+		encoded := expvar.Get("Stages").(*expvar.Map).Get(name).String()
+		if err := json.Unmarshal([]byte(encoded), &stats); err != nil {
+			panic(err)
+		}
+		fmt.Printf("%s reports counters: %v\n", name, stats.Counters != nil)
+	}
+	fmt.Println("Total:", expvar.Get("Counters").(*expvar.Map).Get("ConcurrentRecords"))
+
+	// Output:
+	// CountFirst reports counters: false
+	// CountSecond reports counters: false
+	// Total: 1
+}
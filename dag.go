@@ -0,0 +1,283 @@
+package transformer
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sburnett/transformer/store"
+)
+
+// Compute the stages that each stage must wait for. A stage depends on an
+// earlier stage if it names that stage in DependsOn, if it reads data the
+// earlier stage writes, or if it writes data the earlier stage reads or
+// writes. A Loop writes its Scratch stores. We compare data using
+// store.Identities. Names in DependsOn that aren't in the pipeline (e.g.,
+// because of -run_only) are ignored.
+func (pipeline Pipeline) dependencies() [][]int {
+	stageIndices := make(map[string]int)
+	var reads, writes []map[string]bool
+	for idx, stage := range pipeline {
+		stageIndices[stage.Name] = idx
+		reads = append(reads, identitySet(stageInputs(stage)))
+		writes = append(writes, stageWrites(stage))
+	}
+
+	dependencies := make([][]int, len(pipeline))
+	for idx, stage := range pipeline {
+		dependsOn := make(map[int]bool)
+		for _, name := range stage.DependsOn {
+			if earlier, ok := stageIndices[name]; ok && earlier < idx {
+				dependsOn[earlier] = true
+			}
+		}
+		for earlier := 0; earlier < idx; earlier++ {
+			if intersects(reads[idx], writes[earlier]) || intersects(writes[idx], reads[earlier]) || intersects(writes[idx], writes[earlier]) {
+				dependsOn[earlier] = true
+			}
+		}
+		for earlier := 0; earlier < idx; earlier++ {
+			if dependsOn[earlier] {
+				dependencies[idx] = append(dependencies[idx], earlier)
+			}
+		}
+	}
+	return dependencies
+}
+
+// Return the identities of the data a stage writes. A Loop writes its Scratch
+// stores.
+func stageWrites(stage PipelineStage) map[string]bool {
+	writes := identitySet(stage.Writer)
+	if stage.Loop != nil {
+		for _, scratch := range stage.Loop.Scratch {
+			for identity := range identitySet(scratch) {
+				writes[identity] = true
+			}
+		}
+	}
+	return writes
+}
+
+// Return the identities of all the data a stage reads or writes.
+func stageStores(stage PipelineStage) map[string]bool {
+	stores := stageWrites(stage)
+	for identity := range identitySet(stageInputs(stage)) {
+		stores[identity] = true
+	}
+	return stores
+}
+
+func identitySet(s interface{}) map[string]bool {
+	set := make(map[string]bool)
+	for _, identity := range store.Identities(s) {
+		set[identity] = true
+	}
+	return set
+}
+
+func intersects(a, b map[string]bool) bool {
+	for key := range a {
+		if b[key] {
+			return true
+		}
+	}
+	return false
+}
+
+type stageResult struct {
+	idx int
+	err error
+}
+
+// Run a single stage, periodically logging its progress, and record it in the
+// manifest if it completes.
+func runStage(ctx context.Context, stage PipelineStage, stats *stageStats) error {
+	stats.setEstimatedBytes(estimateInputBytes(stage.Reader))
+	stats.begin()
+	stopProgress := logProgress(stage.Name, stats)
+	var err error
+	if stage.Loop != nil {
+		err = runLoop(ctx, stage, stats)
+	} else {
+		var transformer Transformer
+		transformer, err = stageTransformer(stage)
+		if err == nil {
+			err = runTransformer(ctx, transformer, stage.Reader, stage.Writer, stats)
+		}
+	}
+	stopProgress()
+	stats.finish()
+	if counters, ok := stats.counters(); ok && len(counters) > 0 {
+		log.Printf("Counters for stage %v: %s", stage.Name, formatCounters(counters))
+	}
+	if err != nil {
+		return err
+	}
+	if err := recordCompletedStage(stage, stats); err != nil {
+		log.Printf("Cannot record completion of stage %v in manifest: %v", stage.Name, err)
+	}
+	return nil
+}
+
+// Run a set of pipeline stages, running up to maxConcurrentStages stages at
+// once. A stage starts once every stage it depends on has completed; see
+// PipelineStage.DependsOn for how we determine dependencies. When several
+// stages are ready we start them in pipeline order, so with
+// maxConcurrentStages = 1 this runs stages sequentially, just like
+// RunPipelineContext.
+//
+// We never run two stages that read the same data at the same time, even if
+// neither depends on the other, because only one LevelDbStore can open a
+// LevelDB at once; one of them waits for the other to finish.
+//
+// We record each completed stage in a manifest next to the LevelDBs it writes.
+// We skip stages that have a Version, or all stages if ParsePipelineChoice
+// was given -resume, if the manifest says they're already complete and
+// neither their Version nor their inputs have changed since.
+//
+// We skip stages whose Condition returns false once they're ready to run.
+//
+// We delete temporary stores (see store.NewTemporaryManager) once every stage
+// that reads them has completed, unless ParsePipelineChoice was given
+// -keep_temporary.
+//
+// If a stage fails we cancel the stages that are still running, wait for them
+// to stop and return the first error. The returned error is a *StageError.
+func RunPipelineDAG(ctx context.Context, pipeline Pipeline, maxConcurrentStages int) error {
+	if maxConcurrentStages < 1 {
+		maxConcurrentStages = 1
+	}
+	dependencies := pipeline.dependencies()
+	temporaries := pipeline.temporaryStores()
+	var stores []map[string]bool
+	for _, stage := range pipeline {
+		stores = append(stores, stageStores(stage))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	started := make([]bool, len(pipeline))
+	completed := make([]bool, len(pipeline))
+	ready := func(idx int) bool {
+		for _, dependency := range dependencies[idx] {
+			if !completed[dependency] {
+				return false
+			}
+		}
+		return true
+	}
+
+	statistics := make([]*stageStats, len(pipeline))
+	currentPipeline.reset(pipeline)
+	resultsChan := make(chan stageResult)
+	running := make(map[int]bool)
+	sharesRunningStores := func(idx int) bool {
+		for other := range running {
+			if intersects(stores[idx], stores[other]) {
+				return true
+			}
+		}
+		return false
+	}
+	setCurrentStages := func() {
+		var names []string
+		for idx, stage := range pipeline {
+			if running[idx] {
+				names = append(names, stage.Name)
+			}
+		}
+		currentStage.Set(strings.Join(names, ","))
+	}
+
+	var firstErr error
+	for {
+		for idx, stage := range pipeline {
+			if firstErr != nil || len(running) >= maxConcurrentStages {
+				break
+			}
+			if started[idx] || !ready(idx) || sharesRunningStores(idx) {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				firstErr = &StageError{Stage: stage.Name, Err: err}
+				break
+			}
+			statistics[idx] = newStageStats()
+			stageStatistics.Set(stage.Name, statistics[idx])
+			skipReason := ""
+			if (resumeStages || stage.Version != "") && stageIsComplete(stage) {
+				skipReason = "already complete"
+			} else if stage.Condition != nil {
+				run, err := stage.Condition(stage)
+				if err != nil {
+					started[idx] = true
+					currentPipeline.setState(idx, stageFailed, nil)
+					firstErr = &StageError{Stage: stage.Name, Err: err}
+					cancel()
+					break
+				}
+				if !run {
+					skipReason = "condition is false"
+				}
+			}
+			if skipReason != "" {
+				log.Printf("Skipping %s pipeline stage: %v (%s)", humanize.Ordinal(idx+1), stage.Name, skipReason)
+				statistics[idx].skip()
+				currentPipeline.setState(idx, stageSkipped, statistics[idx])
+				started[idx] = true
+				completed[idx] = true
+				stagesDone.Add(1)
+				removeTemporaryStores(temporaries, completed)
+				continue
+			}
+			for other := range running {
+				statistics[idx].runningWith(statistics[other])
+			}
+			started[idx] = true
+			running[idx] = true
+			setCurrentStages()
+			currentPipeline.setState(idx, stageRunning, statistics[idx])
+			log.Printf("Running %s pipeline stage: %v", humanize.Ordinal(idx+1), stage.Name)
+			go func(idx int, stage PipelineStage, stats *stageStats) {
+				err := runStage(ctx, stage, stats)
+				resultsChan <- stageResult{idx: idx, err: err}
+			}(idx, stage, statistics[idx])
+		}
+		if len(running) == 0 {
+			break
+		}
+
+		result := <-resultsChan
+		delete(running, result.idx)
+		setCurrentStages()
+		stage := pipeline[result.idx]
+		if result.err != nil {
+			if ctx.Err() != nil {
+				currentPipeline.setState(result.idx, stageInterrupted, nil)
+			} else {
+				currentPipeline.setState(result.idx, stageFailed, nil)
+			}
+			if firstErr == nil {
+				if ctx.Err() != nil {
+					log.Printf("Interrupted %s pipeline stage: %v", humanize.Ordinal(result.idx+1), stage.Name)
+				}
+				firstErr = &StageError{Stage: stage.Name, Err: result.err}
+				cancel()
+			}
+			continue
+		}
+		completed[result.idx] = true
+		currentPipeline.setState(result.idx, stageComplete, nil)
+		stagesDone.Add(1)
+		removeTemporaryStores(temporaries, completed)
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	log.Printf("All stages complete")
+	logStageSummary(pipeline, statistics)
+	return nil
+}
@@ -0,0 +1,127 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/sburnett/transformer/store"
+)
+
+func ExampleRunPipelineDAG() {
+	manager := store.NewSliceManager()
+	for _, name := range []string{"left", "right"} {
+		input := manager.Writer(name)
+		input.BeginWriting()
+		input.WriteRecord(store.NewRecord(name, "x", 0))
+		input.EndWriting()
+	}
+
+	identity := MakeMapFunc(func(record *store.Record) *store.Record {
+		return record
+	})
+	pipeline := Pipeline{
+		{
+			Name:        "CopyLeft",
+			Transformer: identity,
+			Reader:      manager.Reader("left"),
+			Writer:      manager.Writer("leftCopy"),
+		},
+		{
+			Name:        "CopyRight",
+			Transformer: identity,
+			Reader:      manager.Reader("right"),
+			Writer:      manager.Writer("rightCopy"),
+		},
+		{
+			Name:        "Merge",
+			Transformer: identity,
+			Reader:      store.NewDemuxingReader(manager.Reader("leftCopy"), manager.Reader("rightCopy")),
+			Writer:      manager.Writer("merged"),
+		},
+	}
+	fmt.Println(pipeline.dependencies())
+
+	if err := RunPipelineDAG(context.Background(), pipeline, 2); err != nil {
+		panic(err)
+	}
+	merged := manager.Reader("merged")
+	merged.BeginReading()
+	for {
+		record, _ := merged.ReadRecord()
+		if record == nil {
+			break
+		}
+		fmt.Printf("%s: %s\n", record.Key, record.Value)
+	}
+	merged.EndReading()
+
+	// Output:
+	// [[] [] [0 1]]
+	// left: x
+	// right: x
+}
+
+func ExampleRunPipelineDAG_sharedInput() {
+	dbRoot, err := ioutil.TempDir("", "transformer-dag-test")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dbRoot)
+	manager := store.NewLevelDbManager(dbRoot)
+	input := manager.Writer("input")
+	input.BeginWriting()
+	for i := 0; i < 5000; i++ {
+		input.WriteRecord(store.NewRecord(fmt.Sprintf("%05d", i), "x", 0))
+	}
+	input.EndWriting()
+
+	// Both stages read the same LevelDB, which only one of them can open at
+	// a time, so we run them one after the other even though neither depends
+	// on the other.
+	slowCopy := TransformFunc(func(inputChan, outputChan chan *store.Record) {
+		time.Sleep(10 * time.Millisecond)
+		for record := range inputChan {
+			outputChan <- record
+		}
+	})
+	pipeline := Pipeline{
+		{
+			Name:        "CopyOnce",
+			Transformer: slowCopy,
+			Reader:      manager.Reader("input"),
+			Writer:      manager.Writer("once"),
+		},
+		{
+			Name:        "CopyTwice",
+			Transformer: slowCopy,
+			Reader:      manager.Reader("input"),
+			Writer:      manager.Writer("twice"),
+		},
+	}
+	fmt.Println(pipeline.dependencies())
+	if err := RunPipelineDAG(context.Background(), pipeline, 2); err != nil {
+		fmt.Println(err)
+	}
+	for _, name := range []string{"once", "twice"} {
+		reader := manager.Reader(name)
+		reader.BeginReading()
+		var count int
+		for {
+			record, _ := reader.ReadRecord()
+			if record == nil {
+				break
+			}
+			count++
+		}
+		reader.EndReading()
+		fmt.Printf("%s: %d records\n", name, count)
+	}
+
+	// Output:
+	// [[] []]
+	// once: 5000 records
+	// twice: 5000 records
+}
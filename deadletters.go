@@ -0,0 +1,185 @@
+package transformer
+
+import (
+	"expvar"
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	"github.com/sburnett/lexicographic-tuples"
+	"github.com/sburnett/transformer/store"
+)
+
+var deadLettersWritten *expvar.Int
+
+func init() {
+	deadLettersWritten = expvar.NewInt("DeadLetters")
+}
+
+type deadLetterQueue struct {
+	writer      store.Writer
+	maxFailures int64
+
+	lock     sync.Mutex
+	users    int
+	writing  bool
+	failures int64
+	sequence int64
+	// The error that made us give up, if any.
+	err error
+}
+
+// Recover when Map, Do or GroupDo panics on a record, write the offending
+// input records to writer and carry on with the next record. Once more than
+// maxFailures calls have panicked, or if we can't write to writer, we give up:
+// we skip the remaining records and TryRunTransformer and TryRunPipeline
+// return an error. Pass a negative maxFailures to never give up. We count
+// failures separately for each run of the transformer, such as each iteration
+// of a Loop.
+//
+// We write one dead letter for each input record of a failed call. Use
+// DecodeDeadLetter to read them. We count dead letters in the DeadLetters
+// expvar variable.
+func DeadLetters(writer store.Writer, maxFailures int) Option {
+	return func(options *transformerOptions) {
+		options.deadLetters = &deadLetterQueue{
+			writer:      writer,
+			maxFailures: int64(maxFailures),
+		}
+	}
+}
+
+// A record that made a transformer panic, along with the panic message and
+// the stack trace of the goroutine that panicked.
+type DeadLetter struct {
+	Record  *store.Record
+	Message string
+	Stack   string
+}
+
+// Decode a record written to a dead letter store.
+func DecodeDeadLetter(record *store.Record) (*DeadLetter, error) {
+	deadLetter := DeadLetter{Record: &store.Record{}}
+	var sequence int64
+	if _, err := lex.Decode(record.Key, &deadLetter.Record.Key, &deadLetter.Record.DatabaseIndex, &sequence); err != nil {
+		return nil, err
+	}
+	if _, err := lex.Decode(record.Value, &deadLetter.Record.Value, &deadLetter.Message, &deadLetter.Stack); err != nil {
+		return nil, err
+	}
+	return &deadLetter, nil
+}
+
+// Note that a transformer started using the queue. We only begin writing to
+// the dead letter store once something fails. The first user starts a new run,
+// which may fail maxFailures times again. We keep counting the sequence, so
+// dead letters from later runs don't replace earlier ones.
+func (queue *deadLetterQueue) begin() {
+	if queue == nil {
+		return
+	}
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	if queue.users == 0 {
+		queue.failures = 0
+		queue.err = nil
+	}
+	queue.users++
+}
+
+// Note that a transformer stopped using the queue, and end writing to the dead
+// letter store if nobody else is using it.
+func (queue *deadLetterQueue) end() {
+	if queue == nil {
+		return
+	}
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	queue.users--
+	if queue.users == 0 && queue.writing {
+		queue.writing = false
+		if err := queue.writer.EndWriting(); err != nil {
+			queue.fail(&StoreError{Op: "EndWriting", Store: queue.writer, Err: err})
+		}
+	}
+}
+
+// Call process, and if it panics write records to the dead letter store. Once
+// we've given up, we don't call process at all.
+func (queue *deadLetterQueue) protect(records []*store.Record, process func()) {
+	if queue == nil {
+		process()
+		return
+	}
+	if queue.failure() != nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			queue.add(records, fmt.Sprint(r), string(debug.Stack()))
+		}
+	}()
+	process()
+}
+
+func (queue *deadLetterQueue) add(records []*store.Record, message, stack string) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	if queue.err != nil {
+		return
+	}
+	if !queue.writing {
+		if err := queue.writer.BeginWriting(); err != nil {
+			queue.fail(&StoreError{Op: "BeginWriting", Store: queue.writer, Err: err})
+			return
+		}
+		queue.writing = true
+	}
+	for _, record := range records {
+		deadLetter := &store.Record{
+			Key:   lex.EncodeOrDie(record.Key, record.DatabaseIndex, queue.sequence),
+			Value: lex.EncodeOrDie(record.Value, message, stack),
+		}
+		queue.sequence++
+		if err := queue.writer.WriteRecord(deadLetter); err != nil {
+			queue.fail(&StoreError{Op: "WriteRecord", Store: queue.writer, Err: err})
+			return
+		}
+		deadLettersWritten.Add(1)
+	}
+	queue.failures++
+	if queue.maxFailures >= 0 && queue.failures > queue.maxFailures {
+		queue.fail(fmt.Errorf("Giving up after %d failures; the last was: %s", queue.failures, message))
+	}
+}
+
+// Give up because of err. The caller must hold the queue's lock.
+func (queue *deadLetterQueue) fail(err error) {
+	if queue.err == nil {
+		queue.err = err
+	}
+}
+
+// Return the error that made us give up, or nil.
+func (queue *deadLetterQueue) failure() error {
+	if queue == nil {
+		return nil
+	}
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	return queue.err
+}
+
+// Transformers implement this to report an error that made them give up
+// without panicking, such as a dead letter queue giving up. We check it once
+// the transformer's Do or DoBatches returns.
+type failingTransformer interface {
+	failure() error
+}
+
+func transformerFailure(transformer Transformer) error {
+	if failing, ok := transformer.(failingTransformer); ok {
+		return failing.failure()
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package transformer
+
+import (
+	"fmt"
+
+	"github.com/sburnett/lexicographic-tuples"
+	"github.com/sburnett/transformer/store"
+)
+
+func ExampleDeadLetters() {
+	reader := &store.SliceStore{}
+	reader.BeginWriting()
+	reader.WriteRecord(&store.Record{Key: lex.EncodeOrDie("a"), Value: lex.EncodeOrDie(int32(1))})
+	reader.WriteRecord(&store.Record{Key: lex.EncodeOrDie("b"), Value: []byte("x")})
+	reader.WriteRecord(&store.Record{Key: lex.EncodeOrDie("c"), Value: lex.EncodeOrDie(int32(3))})
+	reader.EndWriting()
+
+	deadLetters := &store.SliceStore{}
+	transformer := MakeMapFunc(func(record *store.Record) *store.Record {
+		var value int32
+		lex.DecodeOrDie(record.Value, &value)
+		return &store.Record{
+			Key:   record.Key,
+			Value: lex.EncodeOrDie(value * 2),
+		}
+	}, DeadLetters(deadLetters, 10))
+
+	writer := &store.SliceStore{}
+	RunTransformer(transformer, reader, writer)
+
+	writer.BeginReading()
+	for {
+		record, _ := writer.ReadRecord()
+		if record == nil {
+			break
+		}
+		var key string
+		var value int32
+		lex.DecodeOrDie(record.Key, &key)
+		lex.DecodeOrDie(record.Value, &value)
+		fmt.Printf("%s: %d\n", key, value)
+	}
+	writer.EndReading()
+
+	deadLetters.BeginReading()
+	for {
+		record, _ := deadLetters.ReadRecord()
+		if record == nil {
+			break
+		}
+		deadLetter, err := DecodeDeadLetter(record)
+		if err != nil {
+			panic(err)
+		}
+		var key string
+		lex.DecodeOrDie(deadLetter.Record.Key, &key)
+		fmt.Printf("dead letter %s: %s\n", key, deadLetter.Record.Value)
+	}
+	deadLetters.EndReading()
+
+	// Output:
+	// a: 2
+	// c: 6
+	// dead letter b: x
+}
+
+func ExampleDeadLetters_giveUp() {
+	reader := &store.SliceStore{}
+	reader.BeginWriting()
+	for _, key := range []string{"a", "b", "c"} {
+		reader.WriteRecord(store.NewRecord(key, "x", 0))
+	}
+	reader.EndWriting()
+
+	mapFunc := func(record *store.Record) *store.Record {
+		if string(record.Key) == "b" {
+			panic("can't map b")
+		}
+		return record
+	}
+	transformer := MakeMapFunc(mapFunc, DeadLetters(&store.SliceStore{}, 0))
+	fmt.Println(TryRunTransformer(transformer, reader, &store.SliceStore{}))
+
+	// We count failures for each run separately.
+	transformer = MakeMapFunc(mapFunc, DeadLetters(&store.SliceStore{}, 1))
+	for run := 1; run <= 2; run++ {
+		fmt.Printf("Run %d: %v\n", run, TryRunTransformer(transformer, reader, &store.SliceStore{}))
+	}
+
+	// We also give up if we can't write dead letters.
+	transformer = MakeMapFunc(mapFunc, DeadLetters(&failingWriter{}, -1))
+	fmt.Println(TryRunPipeline(Pipeline{
+		{
+			Name:        "Map",
+			Transformer: transformer,
+			Reader:      reader,
+			Writer:      &store.SliceStore{},
+		},
+	}))
+
+	// Output:
+	// Giving up after 1 failures; the last was: can't map b
+	// Run 1: <nil>
+	// Run 2: <nil>
+	// stage Map: WriteRecord on *transformer.failingWriter: disk full
+}
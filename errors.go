@@ -0,0 +1,63 @@
+package transformer
+
+import (
+	"fmt"
+
+	"github.com/sburnett/transformer/store"
+)
+
+// A StoreError records a failed operation on a Reader or Writer while running
+// a transformer. Op is the name of the method that failed (e.g., "ReadRecord"
+// or "EndWriting") and Store is the store on which we called it.
+type StoreError struct {
+	Op    string
+	Store interface{}
+	Err   error
+}
+
+func (e *StoreError) Error() string {
+	return fmt.Sprintf("%s on %s: %v", e.Op, storeName(e.Store), e.Err)
+}
+
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
+
+// A StageError records the pipeline stage that was running when an error
+// occurred.
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("stage %s: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// Describe a store for error messages. Stores can provide a more useful
+// description (e.g., the path to a LevelDB) by implementing fmt.Stringer.
+func storeName(s interface{}) string {
+	if stringer, ok := s.(fmt.Stringer); ok {
+		return fmt.Sprintf("%T(%s)", s, stringer.String())
+	}
+	return fmt.Sprintf("%T", s)
+}
+
+// A GroupKeyError records a record whose key a CheckedGrouper couldn't split
+// into a group prefix.
+type GroupKeyError struct {
+	Record *store.Record
+	Err    error
+}
+
+func (e *GroupKeyError) Error() string {
+	return fmt.Sprintf("can't decode group prefix of key %q: %v", e.Record.Key, e.Err)
+}
+
+func (e *GroupKeyError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,65 @@
+package transformer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sburnett/transformer/store"
+)
+
+// Write a Graphviz DOT graph of the pipeline to w. Stages are boxes and the
+// stores they read and write are cylinders, with edges showing the direction
+// data flows. We look through wrappers like store.DemuxingReader to the stores
+// they wrap and identify stores using store.Identity, so stages that read and
+// write the same LevelDB (e.g., because they got it from the same Manager
+// with the same parameters) share a node. Dashed edges show dependencies from
+// DependsOn. Render the graph with, e.g., "dot -Tsvg".
+func (pipeline Pipeline) WriteDot(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "digraph pipeline {")
+	fmt.Fprintln(out, "  rankdir=LR;")
+	stageNodes := make(map[string]string)
+	for idx, stage := range pipeline {
+		stageNodes[stage.Name] = fmt.Sprintf("stage%d", idx)
+		fmt.Fprintf(out, "  stage%d [label=%s, shape=box];\n", idx, dotQuote(stage.Name))
+	}
+	storeNodes := make(map[string]string)
+	storeNode := func(leaf interface{}) string {
+		identity := store.Identity(leaf)
+		if node, ok := storeNodes[identity]; ok {
+			return node
+		}
+		node := fmt.Sprintf("store%d", len(storeNodes))
+		storeNodes[identity] = node
+		label := fmt.Sprintf("%T", leaf)
+		if _, ok := leaf.(store.Identifier); ok {
+			label = identity
+		}
+		fmt.Fprintf(out, "  %s [label=%s, shape=cylinder];\n", node, dotQuote(label))
+		return node
+	}
+	for idx, stage := range pipeline {
+		for _, leaf := range store.Leaves(stageInputs(stage)) {
+			fmt.Fprintf(out, "  %s -> stage%d;\n", storeNode(leaf), idx)
+		}
+		for _, leaf := range store.Leaves(stage.Writer) {
+			fmt.Fprintf(out, "  stage%d -> %s;\n", idx, storeNode(leaf))
+		}
+		for _, name := range stage.DependsOn {
+			if node, ok := stageNodes[name]; ok {
+				fmt.Fprintf(out, "  %s -> stage%d [style=dashed];\n", node, idx)
+			}
+		}
+	}
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+func dotQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return `"` + s + `"`
+}
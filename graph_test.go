@@ -0,0 +1,51 @@
+package transformer
+
+import (
+	"os"
+
+	"github.com/sburnett/transformer/store"
+)
+
+func ExamplePipeline_WriteDot() {
+	manager := store.NewLevelDbManager("/data")
+	pipeline := Pipeline{
+		{
+			Name:   "Parse",
+			Reader: manager.Reader("raw"),
+			Writer: manager.Writer("parsed"),
+		},
+		{
+			Name:   "Join",
+			Reader: store.NewDemuxingReader(manager.Reader("parsed"), manager.Reader("lookup")),
+			Writer: manager.Writer("joined"),
+		},
+		{
+			Name:      "Summarize",
+			Reader:    manager.Reader("joined"),
+			Writer:    manager.Writer("summary"),
+			DependsOn: []string{"Parse"},
+		},
+	}
+	pipeline.WriteDot(os.Stdout)
+
+	// Output:
+	// digraph pipeline {
+	//   rankdir=LR;
+	//   stage0 [label="Parse", shape=box];
+	//   stage1 [label="Join", shape=box];
+	//   stage2 [label="Summarize", shape=box];
+	//   store0 [label="leveldb:/data/raw", shape=cylinder];
+	//   store0 -> stage0;
+	//   store1 [label="leveldb:/data/parsed", shape=cylinder];
+	//   stage0 -> store1;
+	//   store1 -> stage1;
+	//   store2 [label="leveldb:/data/lookup", shape=cylinder];
+	//   store2 -> stage1;
+	//   store3 [label="leveldb:/data/joined", shape=cylinder];
+	//   stage1 -> store3;
+	//   store3 -> stage2;
+	//   store4 [label="leveldb:/data/summary", shape=cylinder];
+	//   stage2 -> store4;
+	//   stage0 -> stage2 [style=dashed];
+	// }
+}
@@ -134,3 +134,149 @@ func (grouper *Grouper) NextRecord() bool {
 func (grouper *Grouper) Read() *store.Record {
 	return grouper.currentRecord
 }
+
+// A CheckedGrouper groups records like a Grouper, but returns an error
+// instead of panicking when it can't decode a key's prefix, lets you skip the
+// rest of a group, and never changes the records it reads.
+type CheckedGrouper struct {
+	inputChan     chan *store.Record
+	prefixValues  []interface{}
+	prefix        []byte
+	started       bool
+	inGroup       bool
+	currentRecord *store.Record
+	nextRecord    *store.Record
+}
+
+// Construct a new CheckedGrouper, which reads records from the provided input
+// channel and groups them by identical prefixValues, like GroupRecords.
+//
+//    var name string
+//    var year, month int32
+//    grouper := GroupRecordsChecked(records, &name, &year, &month)
+//    for {
+//      ok, err := grouper.NextGroup()
+//      if err != nil {
+//        log.Printf("Skipping record: %v", err)
+//        continue
+//      }
+//      if !ok {
+//        break
+//      }
+//      if name == "Nobody" {
+//        grouper.SkipGroup()
+//        continue
+//      }
+//      for grouper.NextRecord() {
+//        ...
+//      }
+//    }
+func GroupRecordsChecked(inputChan chan *store.Record, prefixValues ...interface{}) *CheckedGrouper {
+	return &CheckedGrouper{
+		inputChan:    inputChan,
+		prefixValues: prefixValues,
+	}
+}
+
+func (grouper *CheckedGrouper) readRecord() *store.Record {
+	newRecord, ok := <-grouper.inputChan
+	if !ok {
+		return nil
+	}
+	if newRecord == nil {
+		panic("Records should never be nil")
+	}
+	return newRecord
+}
+
+// Advance to the next group of records with identical prefixes, decode the
+// prefix into the prefixValues passed to GroupRecordsChecked, and return true,
+// or return false if there are no more records. If you haven't read all the
+// records in the current group, we skip the rest of them.
+//
+// If we can't decode the prefix of the first record in the next group, we
+// return a *GroupKeyError and discard that record; call NextGroup again to
+// carry on with the records after it.
+func (grouper *CheckedGrouper) NextGroup() (bool, error) {
+	grouper.SkipGroup()
+	if !grouper.started {
+		grouper.started = true
+		grouper.nextRecord = grouper.readRecord()
+	}
+	record := grouper.nextRecord
+	if record == nil {
+		return false, nil
+	}
+	grouper.nextRecord = nil
+	prefix, _, err := lex.DecodeAndSplit(record.Key, grouper.prefixValues...)
+	if err != nil {
+		grouper.nextRecord = grouper.readRecord()
+		return false, &GroupKeyError{Record: record, Err: err}
+	}
+	grouper.prefix = prefix
+	grouper.inGroup = true
+	grouper.nextRecord = record
+	return true, nil
+}
+
+// Advance to the next record within the current group, or return false if
+// there are no more records in the group.
+func (grouper *CheckedGrouper) NextRecord() bool {
+	grouper.currentRecord = nil
+	if !grouper.inGroup {
+		return false
+	}
+	record := grouper.nextRecord
+	if record == nil {
+		record = grouper.readRecord()
+	}
+	grouper.nextRecord = nil
+	if record == nil || !bytes.HasPrefix(record.Key, grouper.prefix) {
+		grouper.nextRecord = record
+		grouper.inGroup = false
+		return false
+	}
+	grouper.currentRecord = record
+	return true
+}
+
+// Discard the remaining records in the current group without decoding them.
+// The next call to NextGroup advances to the following group.
+func (grouper *CheckedGrouper) SkipGroup() {
+	for grouper.NextRecord() {
+	}
+}
+
+// Return the encoded prefix shared by the records in the current group, or nil
+// before the first call to NextGroup.
+func (grouper *CheckedGrouper) Prefix() []byte {
+	return grouper.prefix
+}
+
+// Decode the current group's prefix into values, which needn't be the
+// prefixValues passed to GroupRecordsChecked. For example, a goroutine can
+// decode the prefix into its own variables.
+func (grouper *CheckedGrouper) DecodePrefix(values ...interface{}) error {
+	_, err := lex.Decode(grouper.prefix, values...)
+	return err
+}
+
+// Return the current record in the current group with the group's prefix
+// removed from its key, or nil at the end of a group. The returned record is a
+// copy; the record we read is unchanged and available from ReadOriginal.
+func (grouper *CheckedGrouper) Read() *store.Record {
+	if grouper.currentRecord == nil {
+		return nil
+	}
+	return &store.Record{
+		Key:           grouper.currentRecord.Key[len(grouper.prefix):],
+		Value:         grouper.currentRecord.Value,
+		DatabaseIndex: grouper.currentRecord.DatabaseIndex,
+	}
+}
+
+// Return the current record in the current group exactly as we read it, or nil
+// at the end of a group.
+func (grouper *CheckedGrouper) ReadOriginal() *store.Record {
+	return grouper.currentRecord
+}
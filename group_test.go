@@ -48,3 +48,53 @@ func ExampleGrouper() {
 	// [0] world 10 blah
 	// [0] whatever 15 foo
 }
+
+func ExampleCheckedGrouper() {
+	records := make(chan *store.Record, 10)
+	records <- makeRecord("hello", int32(10), "foo")
+	records <- makeRecord("hello", int32(10), "bar")
+	records <- makeRecord("hello", int32(20), "foo")
+	records <- makeRecord("hello", int32(20), "gorp")
+	records <- &store.Record{Key: []byte("x")}
+	records <- makeRecord("world", int32(10), "blah")
+	records <- makeRecord("whatever", int32(15), "foo")
+	close(records)
+
+	var stringKey string
+	var intKey int32
+	grouper := GroupRecordsChecked(records, &stringKey, &intKey)
+
+	for {
+		ok, err := grouper.NextGroup()
+		if err != nil {
+			fmt.Printf("skipping record with key %q\n", err.(*GroupKeyError).Record.Key)
+			continue
+		}
+		if !ok {
+			break
+		}
+		if intKey == 20 {
+			grouper.SkipGroup()
+			continue
+		}
+		var prefixString string
+		var prefixInt int32
+		grouper.DecodePrefix(&prefixString, &prefixInt)
+		for grouper.NextRecord() {
+			var joinedString string
+			lex.DecodeOrDie(grouper.Read().Key, &joinedString)
+			// The record we read still has its whole key.
+			var originalString, originalJoinedString string
+			var originalInt int32
+			lex.DecodeOrDie(grouper.ReadOriginal().Key, &originalString, &originalInt, &originalJoinedString)
+			fmt.Printf("%s %d %s (%s %d %s)\n", prefixString, prefixInt, joinedString, originalString, originalInt, originalJoinedString)
+		}
+	}
+
+	// Output:
+	// hello 10 foo (hello 10 foo)
+	// hello 10 bar (hello 10 bar)
+	// skipping record with key "x"
+	// world 10 blah (world 10 blah)
+	// whatever 15 foo (whatever 15 foo)
+}
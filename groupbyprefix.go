@@ -0,0 +1,150 @@
+package transformer
+
+import (
+	"bytes"
+
+	"github.com/sburnett/lexicographic-tuples"
+	"github.com/sburnett/transformer/store"
+)
+
+// Process a group of records that share an encoded key prefix. Each record's
+// key has the prefix removed, like the records Grouper.Read returns. Decode
+// the prefix with lex.DecodeOrDie into your own variables; don't read the
+// prefix variables passed to MakeGroupByPrefixTransformer, which change as we
+// split the input.
+//
+// PrefixGroupDo will be invoked concurrently from many goroutines, so access
+// to shared state must be synchronized.
+type PrefixGroupDoer interface {
+	PrefixGroupDo(prefix []byte, records []*store.Record, outputChan chan *store.Record)
+}
+
+type PrefixGroupDoFunc func(prefix []byte, records []*store.Record, outputChan chan *store.Record)
+
+func (prefixGroupDoFunc PrefixGroupDoFunc) PrefixGroupDo(prefix []byte, records []*store.Record, outputChan chan *store.Record) {
+	prefixGroupDoFunc(prefix, records, outputChan)
+}
+
+// Emit each group's outputs together and in the same order as the groups in
+// the input. Only applies to MakeGroupByPrefixTransformer.
+func PreserveOrder() Option {
+	return func(options *transformerOptions) {
+		options.preserveOrder = true
+	}
+}
+
+type prefixGroup struct {
+	prefix []byte
+	// The records as we read them, which we write to the dead letter queue.
+	records []*store.Record
+	// The records with the prefix removed from their keys.
+	strippedRecords []*store.Record
+}
+
+type groupByPrefixTransformer struct {
+	doer         PrefixGroupDoer
+	prefixValues []interface{}
+	options      transformerOptions
+}
+
+// Turn a PrefixGroupDoer into a Transformer that processes groups of records
+// on many goroutines. We group records like GroupRecords does, by decoding
+// prefixValues from the start of each key, and always pass all the records of
+// a group to a single call to PrefixGroupDo. Unlike GroupRecords, we don't
+// change the keys of the input records; we pass copies to PrefixGroupDo.
+//
+// Outputs from different groups can be interleaved, unless you set the
+// PreserveOrder option. BufferSize is the number of groups we will process
+// ahead of the oldest group whose outputs we haven't emitted yet. With the
+// DeadLetters option, we write records whose keys don't start with
+// prefixValues to the dead letter store and skip them.
+func MakeGroupByPrefixTransformer(doer PrefixGroupDoer, prefixValues []interface{}, options ...Option) Transformer {
+	return groupByPrefixTransformer{doer, prefixValues, makeOptions(options)}
+}
+
+// Turn a PrefixGroupDoFunc into a Transformer.
+func MakeGroupByPrefixFunc(prefixGroupDoFunc PrefixGroupDoFunc, prefixValues []interface{}, options ...Option) Transformer {
+	return MakeGroupByPrefixTransformer(PrefixGroupDoFunc(prefixGroupDoFunc), prefixValues, options...)
+}
+
+func (transformer groupByPrefixTransformer) Do(inputChan, outputChan chan *store.Record) {
+	deadLetters := transformer.options.deadLetters
+	deadLetters.begin()
+	defer deadLetters.end()
+
+	if transformer.options.preserveOrder {
+		transformer.options.doInOrder(func(sendJob func(orderedJob)) {
+			transformer.splitGroups(inputChan, func(group prefixGroup) {
+				sendJob(orderedJob{
+					records: group.records,
+					process: func() []*store.Record {
+						return collectRecords(func(recordsChan chan *store.Record) {
+							transformer.doer.PrefixGroupDo(group.prefix, group.strippedRecords, recordsChan)
+						})
+					},
+				})
+			})
+		}, outputChan)
+		return
+	}
+
+	workers := transformer.options.numWorkers()
+	bufferSize := transformer.options.bufferSize
+	if bufferSize < 0 {
+		bufferSize = 0
+	}
+	groupsChan := make(chan prefixGroup, bufferSize)
+	doneChan := make(chan bool)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for group := range groupsChan {
+				deadLetters.protect(group.records, func() {
+					transformer.doer.PrefixGroupDo(group.prefix, group.strippedRecords, outputChan)
+				})
+			}
+			doneChan <- true
+		}()
+	}
+	transformer.splitGroups(inputChan, func(group prefixGroup) {
+		groupsChan <- group
+	})
+	close(groupsChan)
+	for i := 0; i < workers; i++ {
+		<-doneChan
+	}
+}
+
+func (transformer groupByPrefixTransformer) failure() error {
+	return transformer.options.deadLetters.failure()
+}
+
+// Split the input into groups with identical prefixes and send each group to
+// sendGroup. We skip records whose prefixes we can't decode.
+func (transformer groupByPrefixTransformer) splitGroups(inputChan chan *store.Record, sendGroup func(prefixGroup)) {
+	var group prefixGroup
+	for record := range inputChan {
+		if group.records == nil || !bytes.HasPrefix(record.Key, group.prefix) {
+			if group.records != nil {
+				sendGroup(group)
+			}
+			group = prefixGroup{}
+			decoded := false
+			transformer.options.deadLetters.protect([]*store.Record{record}, func() {
+				group.prefix, _ = lex.DecodeAndSplitOrDie(record.Key, transformer.prefixValues...)
+				decoded = true
+			})
+			if !decoded {
+				continue
+			}
+		}
+		group.records = append(group.records, record)
+		group.strippedRecords = append(group.strippedRecords, &store.Record{
+			Key:           record.Key[len(group.prefix):],
+			Value:         record.Value,
+			DatabaseIndex: record.DatabaseIndex,
+		})
+	}
+	if group.records != nil {
+		sendGroup(group)
+	}
+}
@@ -0,0 +1,139 @@
+package transformer
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sburnett/lexicographic-tuples"
+	"github.com/sburnett/transformer/store"
+)
+
+type monthlySpending struct {
+	name                 string
+	year, month, dollars int32
+}
+
+var spending = []monthlySpending{
+	{"Bob Smith", 2013, 1, 100},
+	{"Bob Smith", 2013, 2, 20},
+	{"John Doe", 2013, 1, 200},
+	{"John Doe", 2013, 1, 10},
+	{"John Doe", 2013, 2, 30},
+	{"John Doe", 2013, 2, 50},
+	{"John Doe", 2013, 3, 100},
+}
+
+// Sum each month's spending. The first group is slow, so the other groups
+// finish first unless we preserve their order.
+func sumMonthlySpending(options ...Option) Transformer {
+	var name string
+	var year, month int32
+	return MakeGroupByPrefixFunc(func(prefix []byte, records []*store.Record, outputChan chan *store.Record) {
+		var name string
+		var year, month int32
+		lex.DecodeOrDie(prefix, &name, &year, &month)
+		if name == "Bob Smith" && month == 1 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		var monthlySpending int32
+		for _, record := range records {
+			var dollars int32
+			lex.DecodeAndSplitOrDie(record.Key, &dollars)
+			monthlySpending += dollars
+		}
+		outputChan <- &store.Record{
+			Key:   prefix,
+			Value: []byte(fmt.Sprintf("%s spent $%d in %d-%02d", name, monthlySpending, year, month)),
+		}
+	}, []interface{}{&name, &year, &month}, options...)
+}
+
+// Run transformer on records and return the values it outputs, in the order
+// it outputs them. We don't use a store, since stores like SliceStore would
+// sort the outputs.
+func runSpending(transformer Transformer, records []*store.Record) []string {
+	inputChan := make(chan *store.Record, len(records))
+	for _, record := range records {
+		inputChan <- record
+	}
+	close(inputChan)
+	outputChan := make(chan *store.Record, len(records))
+	transformer.Do(inputChan, outputChan)
+	close(outputChan)
+	var values []string
+	for record := range outputChan {
+		values = append(values, string(record.Value))
+	}
+	return values
+}
+
+func spendingRecords() []*store.Record {
+	var records []*store.Record
+	for _, spent := range spending {
+		records = append(records, &store.Record{
+			Key: lex.EncodeOrDie(spent.name, spent.year, spent.month, spent.dollars),
+		})
+	}
+	return records
+}
+
+func ExampleMakeGroupByPrefixTransformer() {
+	for _, value := range runSpending(sumMonthlySpending(Workers(4), PreserveOrder()), spendingRecords()) {
+		fmt.Println(value)
+	}
+
+	// Output:
+	// Bob Smith spent $100 in 2013-01
+	// Bob Smith spent $20 in 2013-02
+	// John Doe spent $210 in 2013-01
+	// John Doe spent $80 in 2013-02
+	// John Doe spent $100 in 2013-03
+}
+
+func ExampleMakeGroupByPrefixTransformer_unordered() {
+	// Without PreserveOrder, outputs come out in whatever order the groups
+	// finish, so we sort them. Negative buffer sizes mean no buffer.
+	values := runSpending(sumMonthlySpending(Workers(4), BufferSize(-1)), spendingRecords())
+	sort.Strings(values)
+	for _, value := range values {
+		fmt.Println(value)
+	}
+
+	// Output:
+	// Bob Smith spent $100 in 2013-01
+	// Bob Smith spent $20 in 2013-02
+	// John Doe spent $100 in 2013-03
+	// John Doe spent $210 in 2013-01
+	// John Doe spent $80 in 2013-02
+}
+
+func ExampleMakeGroupByPrefixTransformer_deadLetters() {
+	// The second record's key doesn't start with a name, year and month.
+	records := spendingRecords()[:2]
+	records = append(records[:1], &store.Record{Key: []byte("garbage")}, records[1])
+
+	deadLetters := &store.SliceStore{}
+	for _, value := range runSpending(sumMonthlySpending(PreserveOrder(), DeadLetters(deadLetters, 10)), records) {
+		fmt.Println(value)
+	}
+
+	deadLetters.BeginReading()
+	for {
+		record, _ := deadLetters.ReadRecord()
+		if record == nil {
+			break
+		}
+		deadLetter, err := DecodeDeadLetter(record)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("dead letter %s\n", deadLetter.Record.Key)
+	}
+	deadLetters.EndReading()
+
+	// Output:
+	// Bob Smith spent $100 in 2013-01
+	// Bob Smith spent $20 in 2013-02
+	// dead letter garbage
+}
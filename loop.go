@@ -0,0 +1,93 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/sburnett/transformer/store"
+)
+
+// A Loop repeats a sub-pipeline until it converges, for iterative algorithms
+// like PageRank or connected components. Set it as the Loop of a
+// PipelineStage, whose Reader holds the input to the first iteration and
+// whose Writer receives the output of the last iteration. The stage's
+// Transformer is ignored.
+//
+// Iterations alternate between the two Scratch stores: the first iteration
+// reads the stage's Reader and writes Scratch[0], the second reads Scratch[0]
+// and writes Scratch[1], the third reads Scratch[1] and writes Scratch[0], and
+// so on. We delete a scratch store's records before an iteration writes to
+// it. Once the loop stops, we copy the last iteration's output to the stage's
+// Writer, so later stages can read the result without knowing how many
+// iterations ran.
+type Loop struct {
+	// Build the stages of an iteration, which read from input and write to
+	// output. The stages run sequentially, so an iteration may have
+	// several stages that each read the previous one's output, and stages
+	// may read other stores, like the edges of a graph. output deletes its
+	// records whenever a stage begins writing to it, so only the last stage
+	// should write to it; give earlier stages stores of your own to pass
+	// their results along.
+	//
+	// We load the stages' SideInputs but otherwise just run their
+	// transformers: we ignore their DependsOn, Version, Condition and Loop,
+	// don't record them in the manifest, and don't delete temporary stores
+	// that only they read.
+	Body func(iteration int, input store.Reader, output store.Writer) Pipeline
+
+	Scratch [2]store.ReadingDeleter
+
+	// Report whether the loop has converged after an iteration. output is
+	// the store that iteration wrote. Transformers in the Body can count
+	// changed records for this to check. If Converged is nil, we run
+	// MaxIterations iterations.
+	Converged func(iteration int, output store.Reader) (bool, error)
+
+	// Stop after this many iterations even if we haven't converged. Zero
+	// means no limit, in which case you must provide Converged.
+	MaxIterations int
+}
+
+// Run the iterations of a stage's Loop, counting their records in stats.
+func runLoop(ctx context.Context, stage PipelineStage, stats *stageStats) error {
+	loop := stage.Loop
+	if loop.Converged == nil && loop.MaxIterations <= 0 {
+		return fmt.Errorf("Loop needs Converged or MaxIterations")
+	}
+	input := stage.Reader
+	var output store.Reader
+	for iteration := 0; loop.MaxIterations <= 0 || iteration < loop.MaxIterations; iteration++ {
+		scratch := loop.Scratch[iteration%2]
+		body := loop.Body(iteration, input, store.NewTruncatingWriter(scratch))
+		for _, subStage := range body {
+			log.Printf("Running %s iteration %d: %s", stage.Name, iteration+1, subStage.Name)
+			transformer, err := stageTransformer(subStage)
+			if err == nil {
+				err = runTransformer(ctx, transformer, subStage.Reader, subStage.Writer, stats)
+			}
+			if err != nil {
+				return fmt.Errorf("iteration %d: %s: %w", iteration+1, subStage.Name, err)
+			}
+		}
+		input, output = scratch, scratch
+		if loop.Converged == nil {
+			continue
+		}
+		converged, err := loop.Converged(iteration, output)
+		if err != nil {
+			return fmt.Errorf("iteration %d: checking convergence: %w", iteration+1, err)
+		}
+		if converged {
+			log.Printf("%s converged after %d iterations", stage.Name, iteration+1)
+			break
+		}
+		if iteration+1 == loop.MaxIterations {
+			log.Printf("%s stopped after %d iterations without converging", stage.Name, iteration+1)
+		}
+	}
+	if stage.Writer == nil {
+		return nil
+	}
+	return runTransformer(ctx, nil, output, stage.Writer, stats)
+}
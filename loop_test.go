@@ -0,0 +1,121 @@
+package transformer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/sburnett/transformer/store"
+)
+
+func ExampleLoop() {
+	input := &store.SliceStore{}
+	input.BeginWriting()
+	input.WriteRecord(store.NewRecord("a", "8", 0))
+	input.WriteRecord(store.NewRecord("b", "3", 0))
+	input.EndWriting()
+
+	// Halve every value until no value changes.
+	var changed int64
+	halve := MakeMapFunc(func(record *store.Record) *store.Record {
+		value, _ := strconv.Atoi(string(record.Value))
+		if value/2 != value {
+			atomic.AddInt64(&changed, 1)
+		}
+		return &store.Record{
+			Key:   record.Key,
+			Value: []byte(strconv.Itoa(value / 2)),
+		}
+	})
+
+	output := &store.SliceStore{}
+	pipeline := Pipeline{
+		{
+			Name:   "Halve",
+			Reader: input,
+			Writer: output,
+			Loop: &Loop{
+				Body: func(iteration int, input store.Reader, output store.Writer) Pipeline {
+					atomic.StoreInt64(&changed, 0)
+					return Pipeline{
+						{
+							Name:        "HalveOnce",
+							Transformer: halve,
+							Reader:      input,
+							Writer:      output,
+						},
+					}
+				},
+				Scratch: [2]store.ReadingDeleter{&store.SliceStore{}, &store.SliceStore{}},
+				Converged: func(iteration int, output store.Reader) (bool, error) {
+					fmt.Printf("Iteration %d changed %d records\n", iteration+1, atomic.LoadInt64(&changed))
+					return atomic.LoadInt64(&changed) == 0, nil
+				},
+				MaxIterations: 10,
+			},
+		},
+	}
+	if err := RunPipelineContext(context.Background(), pipeline); err != nil {
+		panic(err)
+	}
+
+	output.BeginReading()
+	for {
+		record, _ := output.ReadRecord()
+		if record == nil {
+			break
+		}
+		fmt.Printf("%s: %s\n", record.Key, record.Value)
+	}
+	output.EndReading()
+
+	// Output:
+	// Iteration 1 changed 2 records
+	// Iteration 2 changed 2 records
+	// Iteration 3 changed 1 records
+	// Iteration 4 changed 1 records
+	// Iteration 5 changed 0 records
+	// a: 0
+	// b: 0
+}
+
+func ExampleLoop_canceled() {
+	input := &store.SliceStore{}
+	input.BeginWriting()
+	input.WriteRecord(store.NewRecord("a", "8", 0))
+	input.EndWriting()
+
+	// Stop the pipeline after the first iteration.
+	ctx, cancel := context.WithCancel(context.Background())
+	pipeline := Pipeline{
+		{
+			Name:   "Loop",
+			Reader: input,
+			Writer: &store.SliceStore{},
+			Loop: &Loop{
+				Body: func(iteration int, input store.Reader, output store.Writer) Pipeline {
+					return Pipeline{
+						{
+							Name:   "Copy",
+							Reader: input,
+							Writer: output,
+						},
+					}
+				},
+				Scratch: [2]store.ReadingDeleter{&store.SliceStore{}, &store.SliceStore{}},
+				Converged: func(iteration int, output store.Reader) (bool, error) {
+					cancel()
+					return false, nil
+				},
+				MaxIterations: 10,
+			},
+		},
+	}
+	err := RunPipelineContext(ctx, pipeline)
+	fmt.Println(errors.Is(err, context.Canceled))
+
+	// Output:
+	// true
+}
@@ -0,0 +1,186 @@
+package transformer
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sburnett/transformer/store"
+)
+
+// We keep a manifest in each directory that contains LevelDB outputs of a
+// pipeline stage, which is usually the directory passed to NewLevelDbManager.
+const manifestFilename = "transformer-manifest.json"
+
+// A record of a pipeline stage that completed successfully. Inputs and Outputs
+// map the identities of the stages' stores (see store.Identities) to their
+// fingerprints when the stage completed. Stores that don't implement
+// store.Fingerprinter have empty fingerprints. Fingerprint summarizes the
+// stage's Version and the fingerprints of its inputs.
+type ManifestEntry struct {
+	Stage          string
+	Version        string
+	Fingerprint    string
+	Start, End     time.Time
+	RecordsRead    int64
+	RecordsWritten int64
+	Inputs         map[string]string
+	Outputs        map[string]string
+}
+
+// A Manifest records the completed stages of a pipeline, keyed by stage name.
+type Manifest map[string]*ManifestEntry
+
+// Skip stages that ran to completion in a previous run and whose inputs
+// haven't changed since, even if they don't have a Version.
+// ParsePipelineChoice sets this from the -resume flag.
+var resumeStages bool
+
+// Serializes reading and writing manifests when we run stages concurrently.
+var manifestLock sync.Mutex
+
+// Read a manifest from a file. A missing file is an empty manifest.
+func ReadManifest(filename string) (Manifest, error) {
+	manifest := make(Manifest)
+	contents, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Write the manifest to a temporary file and move it into place, so a crash
+// never leaves a truncated manifest behind.
+func (manifest Manifest) write(filename string) error {
+	contents, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	temporaryFilename := filename + ".tmp"
+	if err := ioutil.WriteFile(temporaryFilename, contents, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temporaryFilename, filename)
+}
+
+// Return the path of the manifest for a stage, or the empty string if the
+// stage doesn't write to any LevelDB.
+func stageManifestPath(stage PipelineStage) string {
+	for _, leaf := range store.Leaves(stage.Writer) {
+		if db, ok := leaf.(*store.LevelDbStore); ok {
+			return filepath.Join(filepath.Dir(db.Path()), manifestFilename)
+		}
+	}
+	return ""
+}
+
+// Fingerprint every store underlying s. The fingerprint is empty for stores
+// that don't implement store.Fingerprinter or that we can't fingerprint.
+func fingerprints(s interface{}) map[string]string {
+	fingerprints := make(map[string]string)
+	for _, leaf := range store.Leaves(s) {
+		var fingerprint string
+		if fingerprinter, ok := leaf.(store.Fingerprinter); ok {
+			fingerprint, _ = fingerprinter.Fingerprint()
+		}
+		fingerprints[store.Identity(leaf)] = fingerprint
+	}
+	return fingerprints
+}
+
+// Summarize the stage's Version and the fingerprints of its inputs. The
+// result is empty if we can't fingerprint some input, in which case we can
+// never tell whether the stage's output is up to date.
+func stageFingerprint(stage PipelineStage, inputs map[string]string) string {
+	var identities []string
+	for identity, fingerprint := range inputs {
+		if fingerprint == "" {
+			return ""
+		}
+		identities = append(identities, identity)
+	}
+	sort.Strings(identities)
+	hash := sha1.New()
+	fmt.Fprintf(hash, "version %q\n", stage.Version)
+	for _, identity := range identities {
+		fmt.Fprintf(hash, "input %q %q\n", identity, inputs[identity])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func recordCompletedStage(stage PipelineStage, stats *stageStats) error {
+	filename := stageManifestPath(stage)
+	if filename == "" {
+		return nil
+	}
+	inputs := fingerprints(stageInputs(stage))
+	entry := &ManifestEntry{
+		Stage:          stage.Name,
+		Version:        stage.Version,
+		Fingerprint:    stageFingerprint(stage, inputs),
+		Start:          stats.start,
+		End:            stats.end,
+		RecordsRead:    stats.RecordsRead.Value(),
+		RecordsWritten: stats.RecordsWritten.Value(),
+		Inputs:         inputs,
+		Outputs:        fingerprints(stage.Writer),
+	}
+
+	manifestLock.Lock()
+	defer manifestLock.Unlock()
+	manifest, err := ReadManifest(filename)
+	if err != nil {
+		return err
+	}
+	manifest[stage.Name] = entry
+	return manifest.write(filename)
+}
+
+// A stage is complete if the manifest says it completed, it still writes to
+// the same stores and they all exist, and neither its Version nor the
+// fingerprints of its inputs have changed. We don't compare output
+// fingerprints because reading a LevelDB can change its files; if an output
+// really did change, the stages that read it will notice.
+func stageIsComplete(stage PipelineStage) bool {
+	filename := stageManifestPath(stage)
+	if filename == "" {
+		return false
+	}
+	manifestLock.Lock()
+	manifest, err := ReadManifest(filename)
+	manifestLock.Unlock()
+	if err != nil {
+		return false
+	}
+	entry, ok := manifest[stage.Name]
+	if !ok {
+		return false
+	}
+
+	fingerprint := stageFingerprint(stage, fingerprints(stageInputs(stage)))
+	if fingerprint == "" || fingerprint != entry.Fingerprint {
+		return false
+	}
+	outputs := fingerprints(stage.Writer)
+	if len(outputs) != len(entry.Outputs) {
+		return false
+	}
+	for identity, fingerprint := range outputs {
+		if _, ok := entry.Outputs[identity]; !ok || fingerprint == "" {
+			return false
+		}
+	}
+	return true
+}
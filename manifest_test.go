@@ -0,0 +1,119 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sburnett/transformer/store"
+)
+
+func ExampleReadManifest() {
+	dbRoot, err := ioutil.TempDir("", "transformer-manifest-test")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dbRoot)
+	manager := store.NewLevelDbManager(dbRoot)
+
+	writeInput := func(keys ...string) {
+		input := manager.Writer("input")
+		input.BeginWriting()
+		for _, key := range keys {
+			input.WriteRecord(store.NewRecord(key, "x", 0))
+		}
+		input.EndWriting()
+	}
+
+	runs := 0
+	pipeline := Pipeline{
+		{
+			Name: "Copy",
+			Transformer: TransformFunc(func(inputChan, outputChan chan *store.Record) {
+				runs++
+				for record := range inputChan {
+					outputChan <- record
+				}
+			}),
+			Reader: manager.Reader("input"),
+			Writer: manager.Writer("output"),
+		},
+	}
+
+	resumeStages = true
+	defer func() { resumeStages = false }()
+
+	writeInput("a", "b")
+	if err := RunPipelineContext(context.Background(), pipeline); err != nil {
+		panic(err)
+	}
+	if err := RunPipelineContext(context.Background(), pipeline); err != nil {
+		panic(err)
+	}
+	fmt.Println("Runs after unchanged input:", runs)
+
+	writeInput("c")
+	if err := RunPipelineContext(context.Background(), pipeline); err != nil {
+		panic(err)
+	}
+	fmt.Println("Runs after changed input:", runs)
+
+	manifest, err := ReadManifest(filepath.Join(dbRoot, manifestFilename))
+	if err != nil {
+		panic(err)
+	}
+	entry := manifest["Copy"]
+	fmt.Println(entry.RecordsRead, entry.RecordsWritten)
+
+	// Output:
+	// Runs after unchanged input: 1
+	// Runs after changed input: 2
+	// 3 3
+}
+
+func ExamplePipelineStage_version() {
+	dbRoot, err := ioutil.TempDir("", "transformer-version-test")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dbRoot)
+	manager := store.NewLevelDbManager(dbRoot)
+
+	input := manager.Writer("input")
+	input.BeginWriting()
+	input.WriteRecord(store.NewRecord("a", "x", 0))
+	input.EndWriting()
+
+	runs := 0
+	stage := PipelineStage{
+		Name: "Copy",
+		Transformer: TransformFunc(func(inputChan, outputChan chan *store.Record) {
+			runs++
+			for record := range inputChan {
+				outputChan <- record
+			}
+		}),
+		Reader:  manager.Reader("input"),
+		Writer:  manager.Writer("output"),
+		Version: "1",
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := RunPipelineContext(context.Background(), Pipeline{stage}); err != nil {
+			panic(err)
+		}
+	}
+	fmt.Println("Runs with the same version:", runs)
+
+	stage.Version = "2"
+	if err := RunPipelineContext(context.Background(), Pipeline{stage}); err != nil {
+		panic(err)
+	}
+	fmt.Println("Runs after changing the version:", runs)
+
+	// Output:
+	// Runs with the same version: 1
+	// Runs after changing the version: 2
+}
@@ -0,0 +1,89 @@
+package transformer
+
+import (
+	"github.com/sburnett/transformer/store"
+)
+
+// An Option configures a transformer made by MakeMapTransformer,
+// MakeDoTransformer, MakeGroupDoTransformer, MakeOrderedMapTransformer,
+// MakeOrderedDoTransformer, MakeHashAggregateTransformer,
+// MakeGroupByPrefixTransformer or the constructors built on them.
+type Option func(*transformerOptions)
+
+type transformerOptions struct {
+	workers      int
+	bufferSize   int
+	deadLetters  *deadLetterQueue
+	memoryBudget int
+	tempDir      string
+
+	preserveOrder bool
+}
+
+func makeOptions(options []Option) transformerOptions {
+	var result transformerOptions
+	for _, option := range options {
+		option(&result)
+	}
+	return result
+}
+
+// Run the transformer on this many goroutines. Without this option, we use
+// the value of the -workers flag, which defaults to twice the number of cores.
+func Workers(workers int) Option {
+	return func(options *transformerOptions) {
+		options.workers = workers
+	}
+}
+
+// Let up to this many records (or batches of records) queue up for the
+// transformer's workers, so a slow worker doesn't stall the stage's reader. For
+// ordered transformers, this is the number of records we will process ahead
+// of the oldest record whose outputs we haven't emitted yet. Without this
+// option, workers read straight from the reader and ordered transformers
+// process up to four records per worker ahead.
+func BufferSize(size int) Option {
+	return func(options *transformerOptions) {
+		options.bufferSize = size
+	}
+}
+
+// We look up the -workers flag when the transformer runs rather than when we
+// make it, so you can make transformers before parsing flags.
+func (options transformerOptions) numWorkers() int {
+	if options.workers > 0 {
+		return options.workers
+	}
+	if workers > 0 {
+		return workers
+	}
+	return 1
+}
+
+func (options transformerOptions) bufferRecords(inputChan chan *store.Record) chan *store.Record {
+	if options.bufferSize <= 0 {
+		return inputChan
+	}
+	bufferedChan := make(chan *store.Record, options.bufferSize)
+	go func() {
+		for record := range inputChan {
+			bufferedChan <- record
+		}
+		close(bufferedChan)
+	}()
+	return bufferedChan
+}
+
+func (options transformerOptions) bufferBatches(inputChan chan []*store.Record) chan []*store.Record {
+	if options.bufferSize <= 0 {
+		return inputChan
+	}
+	bufferedChan := make(chan []*store.Record, options.bufferSize)
+	go func() {
+		for batch := range inputChan {
+			bufferedChan <- batch
+		}
+		close(bufferedChan)
+	}()
+	return bufferedChan
+}
@@ -0,0 +1,69 @@
+package transformer
+
+import (
+	"fmt"
+
+	"github.com/sburnett/transformer/store"
+)
+
+func ExampleWorkers() {
+	// Workers(1) keeps the outputs in input order, so this example's output
+	// is predictable. Use larger values for CPU-heavy stages and smaller
+	// values for stages that call rate-limited services.
+	transformer := MakeDoFunc(func(record *store.Record, outputChan chan *store.Record) {
+		outputChan <- &store.Record{Key: []byte(string(record.Key) + "!"), Value: record.Value}
+		outputChan <- record
+	}, Workers(1), BufferSize(16))
+
+	// Read the outputs straight from the transformer, because stores like
+	// SliceStore would sort them.
+	inputChan := make(chan *store.Record, 3)
+	for _, key := range []string{"c", "a", "b"} {
+		inputChan <- store.NewRecord(key, "x", 0)
+	}
+	close(inputChan)
+	outputChan := make(chan *store.Record, 6)
+	transformer.Do(inputChan, outputChan)
+	close(outputChan)
+
+	for record := range outputChan {
+		fmt.Printf("%s\n", record.Key)
+	}
+
+	// Output:
+	// c!
+	// c
+	// a!
+	// a
+	// b!
+	// b
+}
+
+func ExampleBufferSize() {
+	// Negative sizes mean no buffer, like 0.
+	transformer := MakeGroupDoFunc(func(records []*store.Record, outputChan chan *store.Record) {
+		outputChan <- store.NewRecord(string(records[0].Key), fmt.Sprint(len(records)), 0)
+	}, Workers(1), BufferSize(-1))
+
+	reader := &store.SliceStore{}
+	reader.BeginWriting()
+	reader.WriteRecord(store.NewRecord("a", "x", 0))
+	reader.WriteRecord(store.NewRecord("b", "y", 0))
+	reader.EndWriting()
+	writer := &store.SliceStore{}
+	RunTransformer(transformer, reader, writer)
+
+	writer.BeginReading()
+	for {
+		record, _ := writer.ReadRecord()
+		if record == nil {
+			break
+		}
+		fmt.Printf("%s: %s\n", record.Key, record.Value)
+	}
+	writer.EndReading()
+
+	// Output:
+	// a: 1
+	// b: 1
+}
@@ -0,0 +1,135 @@
+package transformer
+
+import (
+	"github.com/sburnett/transformer/store"
+)
+
+// The number of records per worker that an ordered transformer will process
+// ahead of the oldest record whose output it hasn't emitted yet, unless it
+// sets the BufferSize option.
+const reorderBufferPerWorker = 4
+
+type orderedTransformer struct {
+	process func(*store.Record) []*store.Record
+	options transformerOptions
+}
+
+// A unit of work for doInOrder, such as a record or a group of records.
+type orderedJob struct {
+	// The input records, which we write to the dead letter queue if process
+	// panics.
+	records []*store.Record
+	process func() []*store.Record
+}
+
+// Process records on many goroutines but emit their outputs in input order. We
+// queue a slot for each input record in order and only emit a record's outputs
+// once every earlier record's outputs have been emitted, so the number of
+// records in flight is bounded by the size of the queue.
+func makeOrderedTransformer(process func(*store.Record) []*store.Record, options []Option) Transformer {
+	return orderedTransformer{process, makeOptions(options)}
+}
+
+func (transformer orderedTransformer) Do(inputChan, outputChan chan *store.Record) {
+	deadLetters := transformer.options.deadLetters
+	deadLetters.begin()
+	defer deadLetters.end()
+	transformer.options.doInOrder(func(sendJob func(orderedJob)) {
+		for record := range inputChan {
+			record := record
+			sendJob(orderedJob{
+				records: []*store.Record{record},
+				process: func() []*store.Record {
+					return transformer.process(record)
+				},
+			})
+		}
+	}, outputChan)
+}
+
+// Run the jobs that split sends on many goroutines, but emit their outputs to
+// outputChan in the order split sent them. We process up to BufferSize jobs
+// ahead of the oldest job whose outputs we haven't emitted yet. If a job
+// panics, we write its records to the dead letter queue and emit nothing for
+// it.
+func (options transformerOptions) doInOrder(split func(sendJob func(orderedJob)), outputChan chan *store.Record) {
+	workers := options.numWorkers()
+	bufferSize := options.bufferSize
+	if bufferSize <= 0 {
+		bufferSize = reorderBufferPerWorker * workers
+	}
+	type pendingJob struct {
+		job       orderedJob
+		processed chan []*store.Record
+	}
+	jobsChan := make(chan pendingJob)
+	pendingChan := make(chan chan []*store.Record, bufferSize)
+	doneChan := make(chan bool)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for pending := range jobsChan {
+				var outputs []*store.Record
+				options.deadLetters.protect(pending.job.records, func() {
+					outputs = pending.job.process()
+				})
+				pending.processed <- outputs
+			}
+			doneChan <- true
+		}()
+	}
+	go func() {
+		split(func(job orderedJob) {
+			processed := make(chan []*store.Record, 1)
+			pendingChan <- processed
+			jobsChan <- pendingJob{job, processed}
+		})
+		close(jobsChan)
+		close(pendingChan)
+	}()
+	for processed := range pendingChan {
+		for _, record := range <-processed {
+			outputChan <- record
+		}
+	}
+	for i := 0; i < workers; i++ {
+		<-doneChan
+	}
+}
+
+func (transformer orderedTransformer) failure() error {
+	return transformer.options.deadLetters.failure()
+}
+
+// Turn a Mapper into a Transformer that maps records in parallel, like
+// MakeMapTransformer, but emits output records in the same order as their
+// input records. Use this when writing to order-sensitive Writers like
+// CsvStore. If Map returns nil we emit nothing for that record.
+func MakeOrderedMapTransformer(mapper Mapper, options ...Option) Transformer {
+	return makeOrderedTransformer(func(inputRecord *store.Record) []*store.Record {
+		if outputRecord := mapper.Map(inputRecord); outputRecord != nil {
+			return []*store.Record{outputRecord}
+		}
+		return nil
+	}, options)
+}
+
+// Turn a Doer into a Transformer that processes records in parallel, like
+// MakeDoTransformer, but emits the outputs for each input record together and
+// in the same order as the input records.
+func MakeOrderedDoTransformer(doer Doer, options ...Option) Transformer {
+	return makeOrderedTransformer(func(inputRecord *store.Record) []*store.Record {
+		return collectRecords(func(recordsChan chan *store.Record) {
+			doer.Do(inputRecord, recordsChan)
+		})
+	}, options)
+}
+
+// Turn a MapFunc into an ordered Transformer.
+func MakeOrderedMapFunc(mapFunc MapFunc, options ...Option) Transformer {
+	return MakeOrderedMapTransformer(MapFunc(mapFunc), options...)
+}
+
+// Turn a DoFunc into an ordered Transformer.
+func MakeOrderedDoFunc(doFunc DoFunc, options ...Option) Transformer {
+	return MakeOrderedDoTransformer(DoFunc(doFunc), options...)
+}
@@ -0,0 +1,76 @@
+package transformer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sburnett/transformer/store"
+)
+
+func ExampleMakeOrderedMapTransformer() {
+	savedWorkers := workers
+	workers = 4
+	defer func() { workers = savedWorkers }()
+
+	// Earlier records take longer to map, so an unordered transformer would
+	// emit them last.
+	mapper := MakeOrderedMapFunc(func(inputRecord *store.Record) *store.Record {
+		time.Sleep(time.Duration('e'-inputRecord.Key[0]) * time.Millisecond)
+		if string(inputRecord.Key) == "c" {
+			return nil
+		}
+		return inputRecord
+	})
+
+	inputChan := make(chan *store.Record, 5)
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		inputChan <- store.NewRecord(key, "", 0)
+	}
+	close(inputChan)
+	outputChan := make(chan *store.Record, 5)
+	mapper.Do(inputChan, outputChan)
+	close(outputChan)
+
+	for record := range outputChan {
+		fmt.Printf("%s\n", record.Key)
+	}
+
+	// Output:
+	// a
+	// b
+	// d
+	// e
+}
+
+func ExampleMakeOrderedDoTransformer() {
+	savedWorkers := workers
+	workers = 4
+	defer func() { workers = savedWorkers }()
+
+	doer := MakeOrderedDoFunc(func(inputRecord *store.Record, outputChan chan *store.Record) {
+		time.Sleep(time.Duration('d'-inputRecord.Key[0]) * time.Millisecond)
+		outputChan <- store.NewRecord(string(inputRecord.Key), "1", 0)
+		outputChan <- store.NewRecord(string(inputRecord.Key), "2", 0)
+	})
+
+	inputChan := make(chan *store.Record, 3)
+	for _, key := range []string{"a", "b", "c"} {
+		inputChan <- store.NewRecord(key, "", 0)
+	}
+	close(inputChan)
+	outputChan := make(chan *store.Record, 6)
+	doer.Do(inputChan, outputChan)
+	close(outputChan)
+
+	for record := range outputChan {
+		fmt.Printf("%s: %s\n", record.Key, record.Value)
+	}
+
+	// Output:
+	// a: 1
+	// a: 2
+	// b: 1
+	// b: 2
+	// c: 1
+	// c: 2
+}
@@ -1,26 +1,59 @@
 package transformer
 
 import (
+	"context"
 	"expvar"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"sort"
 	"strings"
+	"time"
 
-	"github.com/dustin/go-humanize"
 	"github.com/sburnett/transformer/store"
 )
 
 // A pipeline stage is a single step of data processing, which reads data from
 // Reader, sends each record to Transformer, and writes the resulting Records to
 // Writer. The Name is purely informational.
+//
+// DependsOn names earlier stages that must complete before this one starts.
+// You only need it when running stages concurrently, and only for
+// dependencies we can't infer from the stages' Readers and Writers, such as
+// a Transformer that reads a store on its own.
+//
+// If Loop is set, the stage repeats a sub-pipeline instead of running
+// Transformer; see Loop.
+//
+// If Version is set, we cache the stage's output: we skip the stage if it
+// already completed with the same Version and the same input fingerprints,
+// like a build system. Change the Version whenever you change the
+// Transformer in a way that changes its output. Caching requires that the
+// stage writes to a LevelDB, next to which we keep a manifest of completed
+// stages, and that its inputs implement store.Fingerprinter.
+//
+// SideInputs are small stores, like lookup tables, that we read into memory
+// before the stage starts and pass to every call of a transformer made by
+// MakeSideInputMapFunc, MakeSideInputDoFunc or MakeSideInputGroupDoFunc. The
+// stage fails if they hold more than MaxSideInputBytes of keys and values,
+// which defaults to 256 MB.
+//
+// If Condition is set, we skip the stage when it returns false. See
+// InputNotEmpty and OutputOlderThanInputs for some useful conditions. Stages
+// that depend on a skipped stage still run.
 type PipelineStage struct {
-	Name        string
-	Transformer Transformer
-	Reader      store.Reader
-	Writer      store.Writer
+	Name              string
+	Transformer       Transformer
+	Reader            store.Reader
+	Writer            store.Writer
+	DependsOn         []string
+	Version           string
+	SideInputs        map[string]store.Reader
+	MaxSideInputBytes int64
+	Loop              *Loop
+	Condition         StageCondition
 }
 
 type Pipeline []PipelineStage
@@ -43,20 +76,108 @@ func init() {
 
 type PipelineThunk func() Pipeline
 
+// The context used by RunPipeline and TryRunPipeline. ParsePipelineChoice
+// replaces it with one that is canceled when the process is interrupted.
+var pipelineContext = context.Background()
+
+// Cancel pipelineContext and stop handling interrupts.
+var cancelPipelineContext context.CancelFunc = func() {}
+
+// The maximum number of independent stages RunPipelineContext runs at once.
+// ParsePipelineChoice sets this from the -concurrent_stages flag.
+var maxConcurrentStages = 1
+
+// Return a context that is canceled on the first interrupt signal. Subsequent
+// interrupts get the default behavior, so pressing Ctrl-C twice still kills a
+// stuck pipeline immediately. Canceling the context stops handling interrupts.
+func cancelOnInterrupt(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt)
+	go func() {
+		defer signal.Stop(signalChan)
+		select {
+		case <-signalChan:
+			log.Printf("Interrupted; finishing in-flight records. Interrupt again to exit immediately.")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// Declare a pipeline's flags on flags and return a PipelineThunk that builds
+// the pipeline. ParsePipelineChoiceWithFlags parses the flags before it calls
+// the PipelineThunk, so the thunk can read the values of its flags, and the
+// remaining arguments from flags.Args().
+type PipelineFlagsThunk func(flags *flag.FlagSet) PipelineThunk
+
 // Convenience function to parse command line arguments, figure out which
-// pipeline to run and configure that pipeline to run.
+// pipeline to run and configure that pipeline to run. It also arranges for
+// an interrupt (e.g., Ctrl-C) to stop RunPipeline gracefully.
+//
+// We leave the arguments after the pipeline name in flag.Args() for the
+// pipeline to handle. Use ParsePipelineChoiceWithFlags to have us parse them.
 func ParsePipelineChoice(pipelineThunks map[string]PipelineThunk) (string, Pipeline) {
+	var pipelineNames []string
+	for name := range pipelineThunks {
+		pipelineNames = append(pipelineNames, name)
+	}
+	return parsePipelineChoice(pipelineNames, func(pipelineName string) (PipelineThunk, bool) {
+		pipelineThunk, ok := pipelineThunks[pipelineName]
+		return pipelineThunk, ok
+	})
+}
+
+// Like ParsePipelineChoice, but each pipeline declares its own flags, which
+// we parse from the arguments after the pipeline name. Pass -help after the
+// pipeline name to see them. For example:
+//
+//	pipelines := map[string]transformer.PipelineFlagsThunk{
+//		"summarize": func(flags *flag.FlagSet) transformer.PipelineThunk {
+//			dbRoot := flags.String("db_root", "", "Directory containing the LevelDBs.")
+//			return func() transformer.Pipeline {
+//				return summarizePipeline(*dbRoot)
+//			}
+//		},
+//	}
+//	name, pipeline := transformer.ParsePipelineChoiceWithFlags(pipelines)
+func ParsePipelineChoiceWithFlags(pipelineFlagsThunks map[string]PipelineFlagsThunk) (string, Pipeline) {
+	var pipelineNames []string
+	for name := range pipelineFlagsThunks {
+		pipelineNames = append(pipelineNames, name)
+	}
+	return parsePipelineChoice(pipelineNames, func(pipelineName string) (PipelineThunk, bool) {
+		pipelineFlagsThunk, ok := pipelineFlagsThunks[pipelineName]
+		if !ok {
+			return nil, false
+		}
+		flags := flag.NewFlagSet(pipelineName, flag.ExitOnError)
+		pipelineThunk := pipelineFlagsThunk(flags)
+		flags.Usage = func() {
+			fmt.Fprintf(os.Stderr, "Usage of %s [global flags] %s [pipeline flags]:\n", os.Args[0], pipelineName)
+			fmt.Fprintln(os.Stderr, " [pipeline flags] can be:")
+			flags.PrintDefaults()
+		}
+		flags.Parse(flag.Args()[1:])
+		return pipelineThunk, true
+	})
+}
+
+func parsePipelineChoice(pipelineNames []string, lookup func(pipelineName string) (PipelineThunk, bool)) (string, Pipeline) {
 	runOnly := flag.String("run_only", "", "Comma separated list of stages to run.")
 	runAfter := flag.String("run_from", "", "Run this stage and all stages following it.")
 	listStages := flag.Bool("list_stages", false, "List the stages in the pipeline and exit.")
+	graph := flag.Bool("graph", false, "Write a Graphviz DOT graph of the selected stages and the stores they read and write to stdout and exit.")
+	concurrentStages := flag.Int("concurrent_stages", 1, "Maximum number of independent stages to run at once.")
+	resume := flag.Bool("resume", false, "Skip stages that already completed and whose inputs haven't changed.")
+	progress := flag.Duration("progress_interval", time.Minute, "How often to log the progress of each stage.")
+	keepTemporary := flag.Bool("keep_temporary", false, "Don't delete temporary stores after the stages that read them complete.")
+	statusAddr := flag.String("status_addr", "", "Serve a status page, expvar variables and pprof profiles on this address (e.g., localhost:8080).")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s [global flags] <pipeline> [pipeline flags]:\n", os.Args[0])
 		fmt.Fprintln(os.Stderr, " [global flags] can be:")
 		flag.PrintDefaults()
-		var pipelineNames []string
-		for name := range pipelineThunks {
-			pipelineNames = append(pipelineNames, name)
-		}
 		sort.Strings(pipelineNames)
 		fmt.Fprintln(os.Stderr, " <pipeline> is one of these:", strings.Join(pipelineNames, ", "))
 		fmt.Fprintln(os.Stderr, " Pass '-help' to a pipeline to see [pipeline flags]")
@@ -67,8 +188,21 @@ func ParsePipelineChoice(pipelineThunks map[string]PipelineThunk) (string, Pipel
 		os.Exit(1)
 	}
 	pipelineName := flag.Arg(0)
+	pipelineContext, cancelPipelineContext = cancelOnInterrupt(context.Background())
+	maxConcurrentStages = *concurrentStages
+	resumeStages = *resume
+	progressInterval = *progress
+	keepTemporaryStores = *keepTemporary
+	if len(*statusAddr) > 0 {
+		addr, err := StartStatusServer(*statusAddr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot start status server: %v\n", err)
+			os.Exit(1)
+		}
+		log.Printf("Serving pipeline status on http://%s/", addr)
+	}
 
-	pipelineThunk, ok := pipelineThunks[pipelineName]
+	pipelineThunk, ok := lookup(pipelineName)
 	if !ok {
 		fmt.Fprintf(os.Stderr, "Invalid pipeline!\n\n")
 		flag.Usage()
@@ -79,8 +213,21 @@ func ParsePipelineChoice(pipelineThunks map[string]PipelineThunk) (string, Pipel
 		fmt.Fprintln(os.Stderr, strings.Join(pipeline.StageNames(), "\n"))
 		os.Exit(0)
 	}
-	if len(*runOnly) > 0 {
-		stageNames := strings.Split(*runOnly, ",")
+	pipeline = selectStages(pipelineName, pipeline, *runOnly, *runAfter)
+	if *graph {
+		if err := pipeline.WriteDot(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot write graph: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	return pipelineName, pipeline
+}
+
+// Choose the stages selected by the -run_only or -run_from flags.
+func selectStages(pipelineName string, pipeline Pipeline, runOnly, runAfter string) Pipeline {
+	if len(runOnly) > 0 {
+		stageNames := strings.Split(runOnly, ",")
 		var stagesToRun []PipelineStage
 		for _, stageName := range stageNames {
 			foundStage := false
@@ -97,14 +244,14 @@ func ParsePipelineChoice(pipelineThunks map[string]PipelineThunk) (string, Pipel
 				os.Exit(1)
 			}
 		}
-		return pipelineName, stagesToRun
+		return stagesToRun
 	}
-	if len(*runAfter) > 0 {
-		stageNames := strings.Split(*runAfter, ",")
+	if len(runAfter) > 0 {
+		stageNames := strings.Split(runAfter, ",")
 		for idx, stage := range pipeline {
 			for _, stageName := range stageNames {
 				if stage.Name == stageName {
-					return pipelineName, pipeline[idx:]
+					return pipeline[idx:]
 				}
 			}
 		}
@@ -112,17 +259,35 @@ func ParsePipelineChoice(pipelineThunks map[string]PipelineThunk) (string, Pipel
 		fmt.Fprintf(os.Stderr, "Possible stages:\n  %s\n", strings.Join(pipeline.StageNames(), "\n  "))
 		os.Exit(1)
 	}
-	return pipelineName, pipeline
+	return pipeline
 }
 
-// Run a set of pipeline stages. We run stages
-// sequentially, with no parallelism between stages.
+// Run a set of pipeline stages. By default we run stages sequentially, with no
+// parallelism between stages.
+//
+// RunPipeline panics if a stage fails or the pipeline is interrupted. Use
+// TryRunPipeline to handle those errors yourself.
 func RunPipeline(pipeline Pipeline) {
-	for idx, stage := range pipeline {
-		currentStage.Set(stage.Name)
-		log.Printf("Running %s pipeline stage: %v", humanize.Ordinal(idx+1), stage.Name)
-		RunTransformer(stage.Transformer, stage.Reader, stage.Writer)
-		stagesDone.Add(1)
+	if err := TryRunPipeline(pipeline); err != nil {
+		panic(err)
 	}
-	log.Printf("All stages complete")
+}
+
+// Like RunPipeline, but return an error instead of panicking when a stage
+// fails. We stop at the first failed stage and don't run any stages after it.
+// The returned error is a *StageError wrapping the error from
+// TryRunTransformer.
+func TryRunPipeline(pipeline Pipeline) error {
+	return RunPipelineContext(pipelineContext, pipeline)
+}
+
+// Like TryRunPipeline, but stop once ctx is done. The interrupted stage ends
+// reading and writing on its stores before we return, and we don't start any
+// later stages. The returned error is a *StageError wrapping ctx.Err().
+//
+// Stages run sequentially unless ParsePipelineChoice was given
+// -concurrent_stages, in which case we run independent stages concurrently
+// using RunPipelineDAG.
+func RunPipelineContext(ctx context.Context, pipeline Pipeline) error {
+	return RunPipelineDAG(ctx, pipeline, maxConcurrentStages)
 }
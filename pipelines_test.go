@@ -0,0 +1,53 @@
+package transformer
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sburnett/transformer/store"
+)
+
+func ExampleParsePipelineChoiceWithFlags() {
+	// Pretend we were run as "summarize -run_only=Count count -min_size=10".
+	// Parsing the global flags also changes these settings and handles
+	// interrupts, so undo that afterwards.
+	savedArgs, savedFlags := os.Args, flag.CommandLine
+	savedContext, savedCancel := pipelineContext, cancelPipelineContext
+	savedConcurrentStages, savedResume := maxConcurrentStages, resumeStages
+	savedProgress, savedKeepTemporary := progressInterval, keepTemporaryStores
+	defer func() {
+		cancelPipelineContext()
+		os.Args, flag.CommandLine = savedArgs, savedFlags
+		pipelineContext, cancelPipelineContext = savedContext, savedCancel
+		maxConcurrentStages, resumeStages = savedConcurrentStages, savedResume
+		progressInterval, keepTemporaryStores = savedProgress, savedKeepTemporary
+	}()
+	os.Args = []string{"summarize", "-run_only=Count", "count", "-min_size=10"}
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
+	pipelines := map[string]PipelineFlagsThunk{
+		"count": func(flags *flag.FlagSet) PipelineThunk {
+			minSize := flags.Int("min_size", 0, "Ignore records smaller than this.")
+			return func() Pipeline {
+				fmt.Println("min_size is", *minSize)
+				return Pipeline{
+					{Name: "Filter", Writer: &store.SliceStore{}},
+					{Name: "Count", Writer: &store.SliceStore{}},
+				}
+			}
+		},
+		"other": func(flags *flag.FlagSet) PipelineThunk {
+			flags.String("unused", "", "Only the chosen pipeline's flags are parsed.")
+			return func() Pipeline {
+				return nil
+			}
+		},
+	}
+	name, pipeline := ParsePipelineChoiceWithFlags(pipelines)
+	fmt.Println(name, pipeline.StageNames())
+
+	// Output:
+	// min_size is 10
+	// count [Count]
+}
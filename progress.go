@@ -0,0 +1,61 @@
+package transformer
+
+import (
+	"log"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sburnett/transformer/store"
+)
+
+// How often we log the progress of each running stage. ParsePipelineChoice
+// sets this from the -progress_interval flag.
+var progressInterval = time.Minute
+
+// Estimate the number of bytes we'll read from reader. Return 0 if we can't
+// estimate the size of every store underlying reader.
+func estimateInputBytes(reader store.Reader) int64 {
+	leaves := store.Leaves(reader)
+	if len(leaves) == 0 {
+		return 0
+	}
+	var total uint64
+	for _, leaf := range leaves {
+		sizer, ok := leaf.(store.Sizer)
+		if !ok {
+			return 0
+		}
+		size, err := sizer.ApproximateSize()
+		if err != nil {
+			return 0
+		}
+		total += size
+	}
+	return int64(total)
+}
+
+// Periodically log the progress of a stage until the returned function is
+// called. We log nothing if we can't estimate the size of the stage's input.
+func logProgress(name string, stats *stageStats) func() {
+	if _, _, ok := stats.progress(); !ok || progressInterval <= 0 {
+		return func() {}
+	}
+	done := make(chan bool)
+	ticker := time.NewTicker(progressInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fraction, eta, _ := stats.progress()
+				log.Printf("Stage %v is %.1f%% complete (%s read), ETA %v",
+					name, 100*fraction, humanize.Bytes(uint64(stats.BytesRead.Value())), eta.Round(time.Second))
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
@@ -0,0 +1,26 @@
+package transformer
+
+import (
+	"fmt"
+
+	"github.com/sburnett/transformer/store"
+)
+
+func Example_progress() {
+	fmt.Println(estimateInputBytes(&store.SliceStore{}))
+
+	stats := newStageStats()
+	stats.setEstimatedBytes(200)
+	stats.begin()
+	stats.BytesRead.Add(50)
+	fraction, _, ok := stats.progress()
+	fmt.Println(fraction, ok)
+	stats.BytesRead.Add(250)
+	fraction, eta, ok := stats.progress()
+	fmt.Println(fraction, eta, ok)
+
+	// Output:
+	// 0
+	// 0.25 true
+	// 1 0s true
+}
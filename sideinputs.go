@@ -0,0 +1,201 @@
+package transformer
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sburnett/transformer/store"
+)
+
+// The most bytes of keys and values we load into memory for a stage's side
+// inputs, unless the stage sets MaxSideInputBytes.
+const defaultMaxSideInputBytes = 256 << 20
+
+// An immutable, in-memory copy of a small store, such as a lookup table. If
+// the store has several records with the same key, we keep the first.
+type SideInput struct {
+	records map[string][]byte
+}
+
+// Return the value for key, and whether the side input has that key. Don't
+// modify the returned value.
+func (sideInput *SideInput) Get(key []byte) ([]byte, bool) {
+	value, ok := sideInput.records[string(key)]
+	return value, ok
+}
+
+// The number of records in the side input.
+func (sideInput *SideInput) Len() int {
+	return len(sideInput.records)
+}
+
+// The side inputs of a stage, keyed by the names in PipelineStage.SideInputs.
+// Looking up a name the stage didn't declare panics.
+type SideInputs map[string]*SideInput
+
+// Return the side input with the given name.
+func (sideInputs SideInputs) Get(name string) *SideInput {
+	sideInput, ok := sideInputs[name]
+	if !ok {
+		panic(fmt.Errorf("No side input named %q; declare it in PipelineStage.SideInputs", name))
+	}
+	return sideInput
+}
+
+// Like MapFunc, but also receives the stage's side inputs.
+type SideInputMapFunc func(record *store.Record, sideInputs SideInputs) *store.Record
+
+// Like DoFunc, but also receives the stage's side inputs.
+type SideInputDoFunc func(record *store.Record, sideInputs SideInputs, outputChan chan *store.Record)
+
+// Like GroupDoFunc, but also receives the stage's side inputs.
+type SideInputGroupDoFunc func(records []*store.Record, sideInputs SideInputs, outputChan chan *store.Record)
+
+// A Transformer that uses side inputs, directly or through the transformers
+// it wraps. The pipeline runner loads the stage's side inputs and calls
+// withSideInputs to get the Transformer it runs.
+type sideInputUser interface {
+	withSideInputs(sideInputs SideInputs) Transformer
+}
+
+// A Transformer whose behavior depends on side inputs. Without a pipeline
+// runner to load them, there are no side inputs, so we run the transformer
+// made without them.
+type sideInputTransformer struct {
+	makeTransformer   func(SideInputs) Transformer
+	withoutSideInputs Transformer
+}
+
+func makeSideInputTransformer(makeTransformer func(SideInputs) Transformer) Transformer {
+	return sideInputTransformer{makeTransformer, makeTransformer(SideInputs{})}
+}
+
+func (transformer sideInputTransformer) withSideInputs(sideInputs SideInputs) Transformer {
+	return transformer.makeTransformer(sideInputs)
+}
+
+func (transformer sideInputTransformer) Do(inputChan, outputChan chan *store.Record) {
+	transformer.withoutSideInputs.Do(inputChan, outputChan)
+}
+
+func (transformer sideInputTransformer) DoBatches(inputChan, outputChan chan []*store.Record) {
+	doBatches(transformer.withoutSideInputs, inputChan, outputChan)
+}
+
+func (transformer sideInputTransformer) failure() error {
+	return transformerFailure(transformer.withoutSideInputs)
+}
+
+// Turn a SideInputMapFunc into a Transformer, like MakeMapFunc. Use it in a
+// PipelineStage that declares SideInputs.
+func MakeSideInputMapFunc(mapFunc SideInputMapFunc, options ...Option) Transformer {
+	return makeSideInputTransformer(func(sideInputs SideInputs) Transformer {
+		return MakeMapFunc(func(record *store.Record) *store.Record {
+			return mapFunc(record, sideInputs)
+		}, options...)
+	})
+}
+
+// Turn a SideInputDoFunc into a Transformer, like MakeDoFunc. Use it in a
+// PipelineStage that declares SideInputs.
+func MakeSideInputDoFunc(doFunc SideInputDoFunc, options ...Option) Transformer {
+	return makeSideInputTransformer(func(sideInputs SideInputs) Transformer {
+		return MakeDoFunc(func(record *store.Record, outputChan chan *store.Record) {
+			doFunc(record, sideInputs, outputChan)
+		}, options...)
+	})
+}
+
+// Turn a SideInputGroupDoFunc into a Transformer, like MakeGroupDoFunc. Use it
+// in a PipelineStage that declares SideInputs.
+func MakeSideInputGroupDoFunc(groupDoFunc SideInputGroupDoFunc, options ...Option) Transformer {
+	return makeSideInputTransformer(func(sideInputs SideInputs) Transformer {
+		return MakeGroupDoFunc(func(records []*store.Record, outputChan chan *store.Record) {
+			groupDoFunc(records, sideInputs, outputChan)
+		}, options...)
+	})
+}
+
+// Read each of the stage's side inputs into memory, failing once they hold
+// more than the stage's limit of bytes.
+func loadSideInputs(stage PipelineStage) (SideInputs, error) {
+	maxBytes := stage.MaxSideInputBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxSideInputBytes
+	}
+	var totalBytes int64
+	sideInputs := make(SideInputs)
+	for _, name := range sideInputNames(stage) {
+		reader := stage.SideInputs[name]
+		sideInput := &SideInput{records: make(map[string][]byte)}
+		if err := reader.BeginReading(); err != nil {
+			return nil, &StoreError{Op: "BeginReading", Store: reader, Err: err}
+		}
+		var readErr error
+		for {
+			record, err := reader.ReadRecord()
+			if err != nil {
+				readErr = &StoreError{Op: "ReadRecord", Store: reader, Err: err}
+				break
+			}
+			if record == nil {
+				break
+			}
+			totalBytes += int64(len(record.Key) + len(record.Value))
+			if totalBytes > maxBytes {
+				readErr = fmt.Errorf("side input %s from %s is too large: the stage's side inputs exceed %s; raise PipelineStage.MaxSideInputBytes or join with the store instead", name, storeName(reader), humanize.Bytes(uint64(maxBytes)))
+				break
+			}
+			if _, ok := sideInput.records[string(record.Key)]; !ok {
+				sideInput.records[string(record.Key)] = record.Value
+			}
+		}
+		if err := reader.EndReading(); err != nil && readErr == nil {
+			readErr = &StoreError{Op: "EndReading", Store: reader, Err: err}
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+		sideInputs[name] = sideInput
+	}
+	return sideInputs, nil
+}
+
+func sideInputNames(stage PipelineStage) []string {
+	var names []string
+	for name := range stage.SideInputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Return the Transformer to run for a stage, loading its side inputs if it
+// has any.
+func stageTransformer(stage PipelineStage) (Transformer, error) {
+	transformer, ok := stage.Transformer.(sideInputUser)
+	if !ok {
+		return stage.Transformer, nil
+	}
+	sideInputs, err := loadSideInputs(stage)
+	if err != nil {
+		return nil, err
+	}
+	return transformer.withSideInputs(sideInputs), nil
+}
+
+type storeList []interface{}
+
+func (stores storeList) WrappedStores() []interface{} {
+	return stores
+}
+
+// Return everything the stage reads: its Reader and its side inputs.
+func stageInputs(stage PipelineStage) interface{} {
+	inputs := storeList{stage.Reader}
+	for _, name := range sideInputNames(stage) {
+		inputs = append(inputs, stage.SideInputs[name])
+	}
+	return inputs
+}
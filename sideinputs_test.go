@@ -0,0 +1,131 @@
+package transformer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/sburnett/transformer/store"
+)
+
+func ExampleMakeSideInputMapFunc() {
+	owners := &store.SliceStore{}
+	owners.BeginWriting()
+	owners.WriteRecord(store.NewRecord("device1", "alice", 0))
+	owners.WriteRecord(store.NewRecord("device2", "bob", 0))
+	owners.EndWriting()
+
+	traffic := &store.SliceStore{}
+	traffic.BeginWriting()
+	traffic.WriteRecord(store.NewRecord("device1", "10", 0))
+	traffic.WriteRecord(store.NewRecord("device2", "20", 0))
+	traffic.WriteRecord(store.NewRecord("device3", "30", 0))
+	traffic.EndWriting()
+
+	output := &store.SliceStore{}
+	pipeline := Pipeline{
+		{
+			Name: "AttributeTraffic",
+			Transformer: MakeSideInputMapFunc(func(record *store.Record, sideInputs SideInputs) *store.Record {
+				owner, ok := sideInputs.Get("owners").Get(record.Key)
+				if !ok {
+					owner = []byte("unknown")
+				}
+				return &store.Record{Key: owner, Value: record.Value}
+			}),
+			Reader:     traffic,
+			Writer:     output,
+			SideInputs: map[string]store.Reader{"owners": owners},
+		},
+	}
+	if err := RunPipelineContext(context.Background(), pipeline); err != nil {
+		panic(err)
+	}
+
+	output.BeginReading()
+	for {
+		record, _ := output.ReadRecord()
+		if record == nil {
+			break
+		}
+		fmt.Printf("%s: %s\n", record.Key, record.Value)
+	}
+	output.EndReading()
+
+	pipeline[0].MaxSideInputBytes = 16
+	fmt.Println(RunPipelineContext(context.Background(), pipeline))
+
+	// Output:
+	// alice: 10
+	// bob: 20
+	// unknown: 30
+	// stage AttributeTraffic: side input owners from *store.SliceStore is too large: the stage's side inputs exceed 16 B; raise PipelineStage.MaxSideInputBytes or join with the store instead
+}
+
+func ExampleMakeSideInputMapFunc_chain() {
+	prices := &store.SliceStore{}
+	prices.BeginWriting()
+	prices.WriteRecord(store.NewRecord("apple", "3", 0))
+	prices.WriteRecord(store.NewRecord("pear", "5", 0))
+	prices.EndWriting()
+
+	orders := &store.SliceStore{}
+	orders.BeginWriting()
+	orders.WriteRecord(store.NewRecord("Apple", "alice", 0))
+	orders.WriteRecord(store.NewRecord("Pear", "bob", 0))
+	orders.EndWriting()
+
+	output := &store.SliceStore{}
+	pipeline := Pipeline{
+		{
+			Name: "PriceOrders",
+			Transformer: Chain(
+				MakeMapFunc(func(record *store.Record) *store.Record {
+					return &store.Record{Key: bytes.ToLower(record.Key), Value: record.Value}
+				}),
+				MakeSideInputMapFunc(func(record *store.Record, sideInputs SideInputs) *store.Record {
+					price, _ := sideInputs.Get("prices").Get(record.Key)
+					return &store.Record{Key: record.Value, Value: price}
+				}),
+			),
+			Reader:     orders,
+			Writer:     output,
+			SideInputs: map[string]store.Reader{"prices": prices},
+		},
+	}
+	if err := RunPipelineContext(context.Background(), pipeline); err != nil {
+		panic(err)
+	}
+
+	output.BeginReading()
+	for {
+		record, _ := output.ReadRecord()
+		if record == nil {
+			break
+		}
+		fmt.Printf("%s: %s\n", record.Key, record.Value)
+	}
+	output.EndReading()
+
+	// Output:
+	// alice: 3
+	// bob: 5
+}
+
+func ExampleMakeSideInputMapFunc_deadLetters() {
+	reader := &store.SliceStore{}
+	reader.BeginWriting()
+	reader.WriteRecord(store.NewRecord("device1", "10", 0))
+	reader.EndWriting()
+
+	// Run outside a pipeline, there are no side inputs, so every record
+	// fails.
+	transformer := MakeSideInputMapFunc(func(record *store.Record, sideInputs SideInputs) *store.Record {
+		sideInputs.Get("owners")
+		return record
+	}, DeadLetters(&store.SliceStore{}, 0))
+	fmt.Println(TryRunTransformer(transformer, reader, &store.SliceStore{}))
+
+	// Output:
+	// Giving up after 1 failures; the last was: No side input named "owners"; declare it in PipelineStage.SideInputs
+}
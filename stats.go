@@ -0,0 +1,259 @@
+package transformer
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Statistics for each stage that has run, keyed by stage name.
+var stageStatistics *expvar.Map
+
+func init() {
+	stageStatistics = expvar.NewMap("Stages")
+}
+
+// Statistics about a single run of a transformer. The counters are updated
+// while the stage runs, so you can watch them through expvar.
+type stageStats struct {
+	RecordsRead, RecordsWritten expvar.Int
+	BytesRead, BytesWritten     expvar.Int
+
+	lock               sync.Mutex
+	estimatedBytes     int64
+	start, end         time.Time
+	seeksAtStart       int64
+	seeksAtEnd         int64
+	countersAtStart    map[string]int64
+	countersAtEnd      map[string]int64
+	skipped, completed bool
+	// Whether another stage ran at the same time, so we can't tell which of
+	// them changed the counters.
+	concurrent bool
+}
+
+func newStageStats() *stageStats {
+	return &stageStats{}
+}
+
+func globalSeeks() int64 {
+	if seeks, ok := expvar.Get("Seeks").(*expvar.Int); ok {
+		return seeks.Value()
+	}
+	return 0
+}
+
+func (stats *stageStats) begin() {
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	stats.start = time.Now()
+	stats.seeksAtStart = globalSeeks()
+	stats.countersAtStart = counterValues()
+}
+
+func (stats *stageStats) finish() {
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	stats.end = time.Now()
+	stats.seeksAtEnd = globalSeeks()
+	stats.countersAtEnd = counterValues()
+	stats.completed = true
+}
+
+// Set the estimated number of bytes the stage will read, or 0 if unknown.
+func (stats *stageStats) setEstimatedBytes(estimatedBytes int64) {
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	stats.estimatedBytes = estimatedBytes
+}
+
+// Estimate the fraction of the input we've read and how much longer reading
+// the rest will take. Return false if we don't know how much we'll read.
+func (stats *stageStats) progress() (float64, time.Duration, bool) {
+	stats.lock.Lock()
+	estimatedBytes := stats.estimatedBytes
+	stats.lock.Unlock()
+	if estimatedBytes <= 0 {
+		return 0, 0, false
+	}
+	bytesRead := stats.BytesRead.Value()
+	fraction := float64(bytesRead) / float64(estimatedBytes)
+	if fraction >= 1 {
+		return 1, 0, true
+	}
+	if bytesRead == 0 {
+		return 0, 0, true
+	}
+	elapsed := stats.wallTime()
+	eta := time.Duration(float64(elapsed) * (1 - fraction) / fraction)
+	return fraction, eta, true
+}
+
+func (stats *stageStats) skip() {
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	stats.skipped = true
+}
+
+// Note that the stages with stats and other are running at the same time,
+// unless other has already finished.
+func (stats *stageStats) runningWith(other *stageStats) {
+	other.lock.Lock()
+	defer other.lock.Unlock()
+	if other.completed {
+		return
+	}
+	other.concurrent = true
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	stats.concurrent = true
+}
+
+func (stats *stageStats) wasSkipped() bool {
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	return stats.skipped
+}
+
+// How long the stage has been running, or how long it ran if it's done.
+func (stats *stageStats) wallTime() time.Duration {
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	if stats.start.IsZero() {
+		return 0
+	}
+	if !stats.completed {
+		return time.Since(stats.start)
+	}
+	return stats.end.Sub(stats.start)
+}
+
+// We can't tell which stage a seek belongs to, so this is the change in the
+// global Seeks counter while the stage ran. It includes seeks from any stages
+// running concurrently.
+func (stats *stageStats) seeks() int64 {
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	if stats.start.IsZero() {
+		return 0
+	}
+	if !stats.completed {
+		return globalSeeks() - stats.seeksAtStart
+	}
+	return stats.seeksAtEnd - stats.seeksAtStart
+}
+
+// How much the stage changed each Counter, omitting counters it didn't
+// change. We can't tell which stage called Add, so this is how much each
+// counter changed while the stage ran. The boolean is false if another stage
+// ran at the same time, since some of the changes could be its.
+func (stats *stageStats) counters() (map[string]int64, bool) {
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+	if stats.concurrent {
+		return nil, false
+	}
+	if stats.start.IsZero() {
+		return map[string]int64{}, true
+	}
+	if !stats.completed {
+		return counterDeltas(stats.countersAtStart, counterValues()), true
+	}
+	return counterDeltas(stats.countersAtStart, stats.countersAtEnd), true
+}
+
+// Records per second, counting records read or, for stages without a Reader,
+// records written.
+func (stats *stageStats) throughput() float64 {
+	seconds := stats.wallTime().Seconds()
+	if seconds == 0 {
+		return 0
+	}
+	records := stats.RecordsRead.Value()
+	if records == 0 {
+		records = stats.RecordsWritten.Value()
+	}
+	return float64(records) / seconds
+}
+
+// Implements expvar.Var.
+func (stats *stageStats) String() string {
+	wallTime := stats.wallTime()
+	variables := map[string]interface{}{
+		"RecordsRead":      stats.RecordsRead.Value(),
+		"RecordsWritten":   stats.RecordsWritten.Value(),
+		"BytesRead":        stats.BytesRead.Value(),
+		"BytesWritten":     stats.BytesWritten.Value(),
+		"Seeks":            stats.seeks(),
+		"WallSeconds":      wallTime.Seconds(),
+		"RecordsPerSecond": stats.throughput(),
+		"Skipped":          stats.wasSkipped(),
+	}
+	if counters, ok := stats.counters(); ok {
+		variables["Counters"] = counters
+	}
+	if fraction, eta, ok := stats.progress(); ok {
+		variables["Progress"] = fraction
+		variables["ETASeconds"] = eta.Seconds()
+	}
+	encoded, err := json.Marshal(variables)
+	if err != nil {
+		panic(err)
+	}
+	return string(encoded)
+}
+
+// Format a table summarizing the statistics for each stage.
+func summarizeStages(pipeline Pipeline, statistics []*stageStats) string {
+	var buffer bytes.Buffer
+	writer := tabwriter.NewWriter(&buffer, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "Stage\tRecords in\tRecords out\tBytes in\tBytes out\tSeeks\tWall time\tRecords/s\t")
+	for idx, stage := range pipeline {
+		stats := statistics[idx]
+		if stats == nil {
+			continue
+		}
+		if stats.wasSkipped() {
+			fmt.Fprintf(writer, "%s\t-\t-\t-\t-\t-\tskipped\t-\t\n", stage.Name)
+			continue
+		}
+		fmt.Fprintf(writer, "%s\t%d\t%d\t%s\t%s\t%d\t%v\t%.1f\t\n",
+			stage.Name,
+			stats.RecordsRead.Value(),
+			stats.RecordsWritten.Value(),
+			humanize.Bytes(uint64(stats.BytesRead.Value())),
+			humanize.Bytes(uint64(stats.BytesWritten.Value())),
+			stats.seeks(),
+			stats.wallTime().Round(time.Millisecond),
+			stats.throughput())
+	}
+	writer.Flush()
+
+	var counterLines []string
+	haveCounters := len(counterValues()) > 0
+	for idx, stage := range pipeline {
+		if stats := statistics[idx]; stats != nil && !stats.wasSkipped() {
+			if counters, ok := stats.counters(); !ok && haveCounters {
+				counterLines = append(counterLines, fmt.Sprintf("%s: unknown (ran concurrently with other stages)", stage.Name))
+			} else if ok && len(counters) > 0 {
+				counterLines = append(counterLines, fmt.Sprintf("%s: %s", stage.Name, formatCounters(counters)))
+			}
+		}
+	}
+	if len(counterLines) > 0 {
+		fmt.Fprintf(&buffer, "Counters:\n%s\n", strings.Join(counterLines, "\n"))
+	}
+	return buffer.String()
+}
+
+func logStageSummary(pipeline Pipeline, statistics []*stageStats) {
+	log.Printf("Stage summary:\n%s", summarizeStages(pipeline, statistics))
+}
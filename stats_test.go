@@ -0,0 +1,47 @@
+package transformer
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+
+	"github.com/sburnett/transformer/store"
+)
+
+func Example_stageStatistics() {
+	reader := store.SliceStore{}
+	reader.BeginWriting()
+	for _, key := range []string{"a", "b", "c"} {
+		reader.WriteRecord(store.NewRecord(key, "xyz", 0))
+	}
+	reader.EndWriting()
+
+	pipeline := Pipeline{
+		{
+			Name: "KeepFirst",
+			Transformer: MakeDoFunc(func(record *store.Record, outputChan chan *store.Record) {
+				if string(record.Key) == "a" {
+					outputChan <- record
+				}
+			}),
+			Reader: &reader,
+			Writer: &store.SliceStore{},
+		},
+	}
+	if err := RunPipelineContext(context.Background(), pipeline); err != nil {
+		panic(err)
+	}
+
+	var stats struct {
+		RecordsRead, RecordsWritten, BytesRead, BytesWritten int64
+	}
+	encoded := expvar.Get("Stages").(*expvar.Map).Get("KeepFirst").String()
+	if err := json.Unmarshal([]byte(encoded), &stats); err != nil {
+		panic(err)
+	}
+	fmt.Printf("%+v\n", stats)
+
+	// Output:
+	// {RecordsRead:3 RecordsWritten:1 BytesRead:12 BytesWritten:4}
+}
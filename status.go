@@ -0,0 +1,169 @@
+package transformer
+
+import (
+	"expvar"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// The states of a pipeline stage, as shown on the status page.
+const (
+	stagePending     = "pending"
+	stageRunning     = "running"
+	stageComplete    = "complete"
+	stageSkipped     = "skipped"
+	stageFailed      = "failed"
+	stageInterrupted = "interrupted"
+)
+
+type stageStatus struct {
+	name  string
+	state string
+	stats *stageStats
+}
+
+// The state of the most recently started pipeline, for the status page.
+type pipelineStatus struct {
+	lock   sync.Mutex
+	start  time.Time
+	stages []stageStatus
+}
+
+var currentPipeline pipelineStatus
+
+func (status *pipelineStatus) reset(pipeline Pipeline) {
+	status.lock.Lock()
+	defer status.lock.Unlock()
+	status.start = time.Now()
+	status.stages = make([]stageStatus, len(pipeline))
+	for idx, stage := range pipeline {
+		status.stages[idx] = stageStatus{name: stage.Name, state: stagePending}
+	}
+}
+
+func (status *pipelineStatus) setState(idx int, state string, stats *stageStats) {
+	status.lock.Lock()
+	defer status.lock.Unlock()
+	status.stages[idx].state = state
+	if stats != nil {
+		status.stages[idx].stats = stats
+	}
+}
+
+type stageStatusRow struct {
+	Index          int
+	Name           string
+	State          string
+	RecordsRead    int64
+	RecordsWritten int64
+	BytesRead      string
+	WallTime       time.Duration
+	Throughput     float64
+	Progress       string
+}
+
+type statusPage struct {
+	Uptime                 time.Duration
+	CurrentStage           string
+	StagesComplete, Stages int
+	Rows                   []stageStatusRow
+}
+
+func (status *pipelineStatus) page() statusPage {
+	status.lock.Lock()
+	defer status.lock.Unlock()
+	page := statusPage{
+		CurrentStage: currentStage.Value(),
+		Stages:       len(status.stages),
+	}
+	if !status.start.IsZero() {
+		page.Uptime = time.Since(status.start).Round(time.Second)
+	}
+	for idx, stage := range status.stages {
+		row := stageStatusRow{
+			Index: idx + 1,
+			Name:  stage.name,
+			State: stage.state,
+		}
+		if stage.state == stageComplete || stage.state == stageSkipped {
+			page.StagesComplete++
+		}
+		if stats := stage.stats; stats != nil {
+			row.RecordsRead = stats.RecordsRead.Value()
+			row.RecordsWritten = stats.RecordsWritten.Value()
+			row.BytesRead = humanize.Bytes(uint64(stats.BytesRead.Value()))
+			row.WallTime = stats.wallTime().Round(time.Second)
+			row.Throughput = stats.throughput()
+			if fraction, eta, ok := stats.progress(); ok && stage.state == stageRunning {
+				row.Progress = fmt.Sprintf("%.1f%%, ETA %v", 100*fraction, eta.Round(time.Second))
+			}
+		}
+		page.Rows = append(page.Rows, row)
+	}
+	return page
+}
+
+var statusTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta http-equiv="refresh" content="5">
+<title>Pipeline status</title>
+</head>
+<body>
+<h1>Pipeline status</h1>
+<p>{{.StagesComplete}} of {{.Stages}} stages complete after {{.Uptime}}.</p>
+<p>Current stage: {{if .CurrentStage}}{{.CurrentStage}}{{else}}none{{end}}</p>
+<table>
+<tr><th>#</th><th>Stage</th><th>State</th><th>Records in</th><th>Records out</th><th>Bytes in</th><th>Wall time</th><th>Records/s</th><th>Progress</th></tr>
+{{range .Rows}}<tr><td>{{.Index}}</td><td>{{.Name}}</td><td>{{.State}}</td><td>{{.RecordsRead}}</td><td>{{.RecordsWritten}}</td><td>{{.BytesRead}}</td><td>{{.WallTime}}</td><td>{{printf "%.1f" .Throughput}}</td><td>{{.Progress}}</td></tr>
+{{end}}</table>
+<p><a href="/debug/vars">/debug/vars</a> <a href="/debug/pprof/">/debug/pprof/</a></p>
+</body>
+</html>
+`))
+
+func serveStatusPage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusTemplate.Execute(w, currentPipeline.page()); err != nil {
+		log.Printf("Error rendering status page: %v", err)
+	}
+}
+
+// Serve a status page for running pipelines on addr. The page at / lists the
+// pipeline's stages and their progress. We also serve expvar variables at
+// /debug/vars and profiles at /debug/pprof/. Return the address we're
+// listening on, which is useful if addr doesn't specify a port.
+//
+// ParsePipelineChoice calls this if you pass the -status_addr flag.
+func StartStatusServer(addr string) (string, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", serveStatusPage)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			log.Printf("Status server stopped: %v", err)
+		}
+	}()
+	return listener.Addr().String(), nil
+}
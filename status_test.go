@@ -0,0 +1,52 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/sburnett/transformer/store"
+)
+
+func ExampleStartStatusServer() {
+	addr, err := StartStatusServer("127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	pipeline := Pipeline{
+		{
+			Name: "StatusPageStage",
+			Transformer: TransformFunc(func(inputChan, outputChan chan *store.Record) {
+				outputChan <- store.NewRecord("a", "b", 0)
+			}),
+			Writer: &store.SliceStore{},
+		},
+	}
+	if err := RunPipelineContext(context.Background(), pipeline); err != nil {
+		panic(err)
+	}
+
+	get := func(path string) string {
+		response, err := http.Get("http://" + addr + path)
+		if err != nil {
+			panic(err)
+		}
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			panic(err)
+		}
+		return string(body)
+	}
+	fmt.Println(strings.Contains(get("/"), "<td>StatusPageStage</td><td>complete</td>"))
+	fmt.Println(strings.Contains(get("/debug/vars"), `"StagesComplete"`))
+	fmt.Println(strings.Contains(get("/debug/pprof/"), "goroutine"))
+
+	// Output:
+	// true
+	// true
+	// true
+}
@@ -35,6 +35,13 @@ func NewCsvFile(filename string, keyColumnNames, valueColumnNames []string, colu
 	return NewCsvStore(writer, keyColumnNames, valueColumnNames, columns...)
 }
 
+func (store *CsvStore) Identity() string {
+	if fileCreator, ok := store.writer.(*lazyFileCreator); ok {
+		return "csv:" + fileCreator.filename
+	}
+	return fmt.Sprintf("csv:%p", store.writer)
+}
+
 func (store *CsvStore) BeginWriting() error {
 	store.csvWriter = csv.NewWriter(store.writer)
 	if err := store.csvWriter.Write(append(store.keyColumnNames, store.valueColumnNames...)); err != nil {
@@ -25,6 +25,14 @@ func NewDemuxingReader(readers ...Reader) *DemuxingReader {
 	return &DemuxingReader{readers: readers}
 }
 
+func (demuxer *DemuxingReader) WrappedStores() []interface{} {
+	var stores []interface{}
+	for _, reader := range demuxer.readers {
+		stores = append(stores, reader)
+	}
+	return stores
+}
+
 func (demuxer *DemuxingReader) BeginReading() error {
 	for _, reader := range demuxer.readers {
 		if err := reader.BeginReading(); err != nil {
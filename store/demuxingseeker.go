@@ -20,6 +20,14 @@ func NewDemuxingSeeker(readers ...Seeker) *DemuxingSeeker {
 	return &DemuxingSeeker{readers: readers}
 }
 
+func (demuxer *DemuxingSeeker) WrappedStores() []interface{} {
+	var stores []interface{}
+	for _, reader := range demuxer.readers {
+		stores = append(stores, reader)
+	}
+	return stores
+}
+
 func (demuxer *DemuxingSeeker) BeginReading() error {
 	for _, reader := range demuxer.readers {
 		if err := reader.BeginReading(); err != nil {
@@ -19,6 +19,10 @@ func NewGlobReader(path string) *GlobReader {
 	}
 }
 
+func (reader *GlobReader) Identity() string {
+	return "glob:" + reader.path
+}
+
 func (reader *GlobReader) BeginReading() error {
 	filenames, err := filepath.Glob(reader.path)
 	if err != nil {
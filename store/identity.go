@@ -0,0 +1,46 @@
+package store
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Return the stores that s ultimately reads from or writes to, looking
+// through Wrappers to the stores they wrap.
+func Leaves(s interface{}) []interface{} {
+	if s == nil {
+		return nil
+	}
+	if wrapper, ok := s.(Wrapper); ok {
+		var leaves []interface{}
+		for _, wrapped := range wrapper.WrappedStores() {
+			leaves = append(leaves, Leaves(wrapped)...)
+		}
+		return leaves
+	}
+	return []interface{}{s}
+}
+
+// Return the identity of a store that isn't a Wrapper. Stores that don't
+// implement Identifier are identified by their address, so they only match
+// themselves.
+func Identity(s interface{}) string {
+	if identifier, ok := s.(Identifier); ok {
+		return identifier.Identity()
+	}
+	switch reflect.ValueOf(s).Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+		return fmt.Sprintf("%T:%p", s, s)
+	default:
+		return fmt.Sprintf("%T:%v", s, s)
+	}
+}
+
+// Return the identities of the data that s reads or writes.
+func Identities(s interface{}) []string {
+	var identities []string
+	for _, leaf := range Leaves(s) {
+		identities = append(identities, Identity(leaf))
+	}
+	return identities
+}
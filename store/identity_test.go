@@ -0,0 +1,18 @@
+package store
+
+import (
+	"fmt"
+)
+
+func ExampleIdentities() {
+	manager := NewLevelDbManager("/data")
+	reader := NewDemuxingReader(manager.Reader("users"), manager.Reader("purchases"))
+	writer := NewTruncatingWriter(manager.Deleter("users"))
+
+	fmt.Println(Identities(reader))
+	fmt.Println(Identities(writer))
+
+	// Output:
+	// [leveldb:/data/users leveldb:/data/purchases]
+	// [leveldb:/data/users]
+}
@@ -1,5 +1,9 @@
 package store
 
+import (
+	"time"
+)
+
 // A store from which you can read Records. You must call BeginReading, then
 // ReaderRecord, then EndReading.
 type Reader interface {
@@ -23,6 +27,14 @@ type Seeker interface {
 	Seek([]byte) error
 }
 
+// A Writer that can write a batch of records at once, which is usually faster
+// than calling WriteRecord for each record. Like WriteRecord, WriteRecords can
+// only be used between BeginWriting and EndWriting calls.
+type BatchWriter interface {
+	Writer
+	WriteRecords([]*Record) error
+}
+
 // A Writer that can erase all keys from the store. Like WriteRecord,
 // DeleteAllRecords can only be used between BeginWriting and EndWriting calls.
 type Deleter interface {
@@ -54,6 +66,34 @@ type SeekingDeleter interface {
 	Deleter
 }
 
+// A store that can name the data it reads or writes. Two stores with the same
+// Identity refer to the same data even if they are different objects, as
+// happens when you call a Manager's constructors several times with the same
+// parameters.
+type Identifier interface {
+	Identity() string
+}
+
+// A store that reads from or writes to other stores. For example,
+// DemuxingReader wraps the Readers passed to NewDemuxingReader.
+type Wrapper interface {
+	WrappedStores() []interface{}
+}
+
+// A store that can summarize the current state of its data. The fingerprint
+// must change whenever the data changes. It may also change when the data
+// doesn't (e.g., when LevelDB compacts its files), which only costs us some
+// unnecessary work. Fingerprint returns an error if the store doesn't exist.
+type Fingerprinter interface {
+	Fingerprint() (string, error)
+}
+
+// A store that can estimate how many bytes it contains, e.g., to estimate the
+// progress of reading it.
+type Sizer interface {
+	ApproximateSize() (uint64, error)
+}
+
 // A Manager is an interface for creating stores.
 //
 // The arguments to each creator usually get passed to the store's constructor.
@@ -74,3 +114,15 @@ type Manager interface {
 	ReadingDeleter(...interface{}) ReadingDeleter
 	SeekingDeleter(...interface{}) SeekingDeleter
 }
+
+// A store that can delete its data entirely, including any files or
+// directories holding it. Callers must end reading and writing first.
+type Remover interface {
+	Remove() error
+}
+
+// A store that knows when its data last changed. ModTime returns an error
+// satisfying os.IsNotExist if the store doesn't exist.
+type ModTimer interface {
+	ModTime() (time.Time, error)
+}
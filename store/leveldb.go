@@ -1,10 +1,16 @@
 package store
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"expvar"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/jmhodges/levigo"
 )
@@ -73,6 +79,20 @@ func (store *LevelDbStore) closeDatabase() {
 	store.dbOpts.Close()
 }
 
+// The path to the database, so errors and logs can identify the store.
+func (store *LevelDbStore) String() string {
+	return store.dbPath
+}
+
+// The path to the database.
+func (store *LevelDbStore) Path() string {
+	return store.dbPath
+}
+
+func (store *LevelDbStore) Identity() string {
+	return "leveldb:" + filepath.Clean(store.dbPath)
+}
+
 func (store *LevelDbStore) BeginReading() error {
 	store.dbOpenLock.Lock()
 	defer store.dbOpenLock.Unlock()
@@ -106,9 +126,10 @@ func (store *LevelDbStore) ReadRecord() (*Record, error) {
 func (store *LevelDbStore) EndReading() error {
 	store.dbOpenLock.Lock()
 	defer store.dbOpenLock.Unlock()
-	store.readOptions.Close()
 	store.readIterator.Close()
+	store.readOptions.Close()
 	store.closeDatabase()
+	store.readIterator = nil
 	store.readOptions = nil
 	return nil
 }
@@ -135,6 +156,23 @@ func (store *LevelDbStore) WriteRecord(record *Record) error {
 	return nil
 }
 
+// Write a batch of records atomically using a LevelDB WriteBatch.
+func (store *LevelDbStore) WriteRecords(records []*Record) error {
+	batch := levigo.NewWriteBatch()
+	defer batch.Close()
+	var batchBytes int64
+	for _, record := range records {
+		batch.Put(record.Key, record.Value)
+		batchBytes += int64(len(record.Key) + len(record.Value))
+	}
+	if err := store.db.Write(store.writeOptions, batch); err != nil {
+		return fmt.Errorf("Error writing to database: %v", err)
+	}
+	recordsWritten.Add(int64(len(records)))
+	bytesWritten.Add(batchBytes)
+	return nil
+}
+
 func (store *LevelDbStore) EndWriting() error {
 	store.dbOpenLock.Lock()
 	defer store.dbOpenLock.Unlock()
@@ -184,6 +222,81 @@ func (store *LevelDbStore) DeleteAllRecords() error {
 	return nil
 }
 
+// Fingerprint the database using the names and sizes of its table and log
+// files. This doesn't read any records, so it's cheap even for huge databases.
+// We ignore empty logs and LevelDB's bookkeeping files, which change every
+// time we open the database.
+func (store *LevelDbStore) Fingerprint() (string, error) {
+	files, err := ioutil.ReadDir(store.dbPath)
+	if err != nil {
+		return "", err
+	}
+	hash := sha1.New()
+	for _, file := range files {
+		if !isLevelDbDataFile(file) {
+			continue
+		}
+		fmt.Fprintf(hash, "%s %d\n", file.Name(), file.Size())
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Return the latest modification time of the database's table and log files,
+// ignoring the same files as Fingerprint.
+func (store *LevelDbStore) ModTime() (time.Time, error) {
+	files, err := ioutil.ReadDir(store.dbPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var modTime time.Time
+	for _, file := range files {
+		if !isLevelDbDataFile(file) {
+			continue
+		}
+		if file.ModTime().After(modTime) {
+			modTime = file.ModTime()
+		}
+	}
+	return modTime, nil
+}
+
+func isLevelDbDataFile(file os.FileInfo) bool {
+	name := file.Name()
+	if !strings.HasSuffix(name, ".sst") && !strings.HasSuffix(name, ".ldb") && !strings.HasSuffix(name, ".log") {
+		return false
+	}
+	return file.Size() > 0
+}
+
+// Estimate the size of the database in bytes by adding up the sizes of its
+// table and log files, ignoring the same files as Fingerprint. This is the
+// size of the database on disk, so it can underestimate the number of bytes
+// you'll read from a compressed database. We don't open the database, so it's
+// safe to call this while another store has the database open.
+func (store *LevelDbStore) ApproximateSize() (uint64, error) {
+	files, err := ioutil.ReadDir(store.dbPath)
+	if err != nil {
+		return 0, err
+	}
+	var size uint64
+	for _, file := range files {
+		if isLevelDbDataFile(file) {
+			size += uint64(file.Size())
+		}
+	}
+	return size, nil
+}
+
+// Delete the database's directory. The database must not be open.
+func (store *LevelDbStore) Remove() error {
+	store.dbOpenLock.Lock()
+	defer store.dbOpenLock.Unlock()
+	if store.readOptions != nil || store.writeOptions != nil {
+		return fmt.Errorf("Cannot remove %s while it is open", store.dbPath)
+	}
+	return os.RemoveAll(store.dbPath)
+}
+
 type levelDbManager string
 
 // Manage a set of LevelDB databases in the provided directory.
@@ -173,3 +173,41 @@ func ExampleLevelDbStore_deleteAll() {
 	// Output:
 	// End of records
 }
+
+func ExampleLevelDbStore_ApproximateSize() {
+	dbPath, err := ioutil.TempDir("", "transformer-leveldb-test")
+	if err != nil {
+		panic(err)
+	}
+
+	store := NewLevelDbStore(dbPath, LevelDbReadWrite)
+	if err := store.BeginWriting(); err != nil {
+		panic(err)
+	}
+	if err := store.WriteRecord(NewRecord("a", "x", 0)); err != nil {
+		panic(err)
+	}
+	if err := store.EndWriting(); err != nil {
+		panic(err)
+	}
+
+	// We can estimate the size while another store is reading the database.
+	if err := store.BeginReading(); err != nil {
+		panic(err)
+	}
+	size, err := NewLevelDbStore(dbPath, LevelDbReadOnly).ApproximateSize()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(size > 0)
+	if err := store.EndReading(); err != nil {
+		panic(err)
+	}
+
+	if err := os.RemoveAll(dbPath); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// true
+}
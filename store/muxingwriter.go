@@ -18,6 +18,14 @@ func NewMuxingWriter(writers ...Writer) MuxingWriter {
 	return MuxingWriter(writers)
 }
 
+func (writers MuxingWriter) WrappedStores() []interface{} {
+	var stores []interface{}
+	for _, writer := range writers {
+		stores = append(stores, writer)
+	}
+	return stores
+}
+
 func (writers MuxingWriter) BeginWriting() error {
 	for _, writer := range writers {
 		if err := writer.BeginWriting(); err != nil {
@@ -20,6 +20,10 @@ func NewPrefixIncludingReader(reader Seeker, includedReader Reader) *PrefixInclu
 	}
 }
 
+func (store *PrefixIncludingReader) WrappedStores() []interface{} {
+	return []interface{}{store.reader, store.includedReader}
+}
+
 func (store *PrefixIncludingReader) BeginReading() error {
 	if err := store.reader.BeginReading(); err != nil {
 		return err
@@ -21,6 +21,10 @@ func NewRangeExcludingReader(reader Seeker, excludedReader Reader) *RangeExcludi
 	}
 }
 
+func (store *RangeExcludingReader) WrappedStores() []interface{} {
+	return []interface{}{store.reader, store.excludedReader}
+}
+
 func (store *RangeExcludingReader) BeginReading() error {
 	if err := store.reader.BeginReading(); err != nil {
 		return err
@@ -21,6 +21,10 @@ func NewRangeIncludingReader(reader Seeker, includedReader Reader) *RangeIncludi
 	}
 }
 
+func (store *RangeIncludingReader) WrappedStores() []interface{} {
+	return []interface{}{store.reader, store.includedReader}
+}
+
 func (store *RangeIncludingReader) BeginReading() error {
 	if err := store.reader.BeginReading(); err != nil {
 		return err
@@ -63,6 +63,12 @@ func (store *SliceStore) DeleteAllRecords() error {
 	return nil
 }
 
+// A SliceStore has nothing to remove besides its records.
+func (store *SliceStore) Remove() error {
+	store.records = nil
+	return nil
+}
+
 func (store *SliceStore) Seek(key []byte) error {
 	store.cursor = -1
 	for store.cursor < len(store.records) {
@@ -0,0 +1,350 @@
+package store
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// The number of bytes of keys and values a SortingWriter buffers in memory
+// before spilling a sorted run to disk, unless you say otherwise.
+const defaultSortBufferBytes = 64 << 20
+
+// The most runs we merge at once. With more runs than this we first merge
+// groups of runs into longer runs, so we never open too many files.
+const maxMergeRuns = 128
+
+type SortingWriter struct {
+	writer         Writer
+	tempDir        string
+	maxBufferBytes int
+
+	runsDir     string
+	buffer      []*Record
+	bufferBytes int
+	runs        []string
+}
+
+// Make a Writer that sorts records by key before writing them to writer, so
+// writers that don't sort on their own, like CsvStore and SqliteStore, receive
+// records in key order. Records with the same key keep the order in which we
+// received them.
+//
+// We buffer up to maxBufferBytes of keys and values in memory, then sort them
+// and spill them to a run file in a new directory under tempDir (or the
+// system's temporary directory if tempDir is empty). EndWriting merges the
+// runs into writer and deletes them. We only begin writing to writer in
+// EndWriting. If maxBufferBytes is 0, we buffer 64 MB.
+func NewSortingWriter(writer Writer, tempDir string, maxBufferBytes int) *SortingWriter {
+	if maxBufferBytes <= 0 {
+		maxBufferBytes = defaultSortBufferBytes
+	}
+	return &SortingWriter{
+		writer:         writer,
+		tempDir:        tempDir,
+		maxBufferBytes: maxBufferBytes,
+	}
+}
+
+func (sorter *SortingWriter) WrappedStores() []interface{} {
+	return []interface{}{sorter.writer}
+}
+
+func (sorter *SortingWriter) BeginWriting() error {
+	sorter.buffer = nil
+	sorter.bufferBytes = 0
+	sorter.runs = nil
+	sorter.runsDir = ""
+	return nil
+}
+
+func (sorter *SortingWriter) WriteRecord(record *Record) error {
+	sorter.buffer = append(sorter.buffer, record)
+	sorter.bufferBytes += len(record.Key) + len(record.Value)
+	if sorter.bufferBytes >= sorter.maxBufferBytes {
+		return sorter.spill()
+	}
+	return nil
+}
+
+func (sorter *SortingWriter) EndWriting() error {
+	if sorter.runsDir != "" {
+		defer os.RemoveAll(sorter.runsDir)
+	}
+	var reader Reader
+	if len(sorter.runs) == 0 {
+		sort.Stable(recordSlice(sorter.buffer))
+		reader = &sliceReader{records: sorter.buffer}
+	} else {
+		if err := sorter.spill(); err != nil {
+			return err
+		}
+		for len(sorter.runs) > maxMergeRuns {
+			if err := sorter.mergeRuns(); err != nil {
+				return err
+			}
+		}
+		reader = newRunMerger(sorter.runs)
+	}
+	sorter.buffer = nil
+	sorter.bufferBytes = 0
+
+	if err := sorter.writer.BeginWriting(); err != nil {
+		return err
+	}
+	if err := copyRecords(reader, sorter.writer); err != nil {
+		sorter.writer.EndWriting()
+		return err
+	}
+	return sorter.writer.EndWriting()
+}
+
+// Sort the buffered records and write them to a new run file.
+func (sorter *SortingWriter) spill() error {
+	if sorter.runsDir == "" {
+		runsDir, err := ioutil.TempDir(sorter.tempDir, "transformer-sort")
+		if err != nil {
+			return err
+		}
+		sorter.runsDir = runsDir
+	}
+	sort.Stable(recordSlice(sorter.buffer))
+	filename := filepath.Join(sorter.runsDir, fmt.Sprintf("run-%d", len(sorter.runs)))
+	if err := writeRun(filename, &sliceReader{records: sorter.buffer}); err != nil {
+		return err
+	}
+	sorter.runs = append(sorter.runs, filename)
+	sorter.buffer = nil
+	sorter.bufferBytes = 0
+	return nil
+}
+
+// Merge the first maxMergeRuns runs into a single run that replaces them at
+// the start of the list, so the runs remain in the order we received their
+// records.
+func (sorter *SortingWriter) mergeRuns() error {
+	filename := filepath.Join(sorter.runsDir, fmt.Sprintf("merged-%d", len(sorter.runs)))
+	merging := sorter.runs[:maxMergeRuns]
+	if err := writeRun(filename, newRunMerger(merging)); err != nil {
+		return err
+	}
+	for _, run := range merging {
+		os.Remove(run)
+	}
+	sorter.runs = append([]string{filename}, sorter.runs[maxMergeRuns:]...)
+	return nil
+}
+
+func copyRecords(reader Reader, writer Writer) error {
+	if err := reader.BeginReading(); err != nil {
+		return err
+	}
+	for {
+		record, err := reader.ReadRecord()
+		if err != nil {
+			reader.EndReading()
+			return err
+		}
+		if record == nil {
+			break
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			reader.EndReading()
+			return err
+		}
+	}
+	return reader.EndReading()
+}
+
+// Reads records from a slice without sorting them, unlike SliceStore.
+type sliceReader struct {
+	records []*Record
+}
+
+func (reader *sliceReader) BeginReading() error { return nil }
+func (reader *sliceReader) EndReading() error   { return nil }
+
+func (reader *sliceReader) ReadRecord() (*Record, error) {
+	if len(reader.records) == 0 {
+		return nil, nil
+	}
+	record := reader.records[0]
+	reader.records = reader.records[1:]
+	return record, nil
+}
+
+// Write the records from reader to a run file. Each record is the length of
+// its key, the key, the length of its value, the value and its DatabaseIndex.
+func writeRun(filename string, reader Reader) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	writer := &runWriter{writer: bufio.NewWriter(file)}
+	if err := copyRecords(reader, writer); err != nil {
+		file.Close()
+		return err
+	}
+	if err := writer.writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+type runWriter struct {
+	writer *bufio.Writer
+}
+
+func (writer *runWriter) BeginWriting() error { return nil }
+func (writer *runWriter) EndWriting() error   { return nil }
+
+func (writer *runWriter) WriteRecord(record *Record) error {
+	var header [binary.MaxVarintLen64]byte
+	for _, field := range [][]byte{record.Key, record.Value} {
+		n := binary.PutUvarint(header[:], uint64(len(field)))
+		if _, err := writer.writer.Write(header[:n]); err != nil {
+			return err
+		}
+		if _, err := writer.writer.Write(field); err != nil {
+			return err
+		}
+	}
+	return writer.writer.WriteByte(record.DatabaseIndex)
+}
+
+// Reads the records from a run file.
+type runReader struct {
+	filename string
+	file     *os.File
+	reader   *bufio.Reader
+}
+
+func (reader *runReader) BeginReading() error {
+	file, err := os.Open(reader.filename)
+	if err != nil {
+		return err
+	}
+	reader.file = file
+	reader.reader = bufio.NewReader(file)
+	return nil
+}
+
+func (reader *runReader) ReadRecord() (*Record, error) {
+	key, err := reader.readField()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	value, err := reader.readField()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	databaseIndex, err := reader.reader.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return &Record{Key: key, Value: value, DatabaseIndex: databaseIndex}, nil
+}
+
+func (reader *runReader) readField() ([]byte, error) {
+	length, err := binary.ReadUvarint(reader.reader)
+	if err != nil {
+		return nil, err
+	}
+	field := make([]byte, length)
+	if _, err := io.ReadFull(reader.reader, field); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return field, nil
+}
+
+func (reader *runReader) EndReading() error {
+	return reader.file.Close()
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Merges sorted runs in key order. Records with the same key come from
+// earlier runs first, so merging preserves the order in which we received
+// them.
+type runMerger struct {
+	readers []Reader
+	records PriorityQueue
+}
+
+func newRunMerger(filenames []string) *runMerger {
+	merger := &runMerger{}
+	for _, filename := range filenames {
+		merger.readers = append(merger.readers, &runReader{filename: filename})
+	}
+	return merger
+}
+
+func (merger *runMerger) BeginReading() error {
+	merger.records = make(PriorityQueue, 0, len(merger.readers))
+	for idx, reader := range merger.readers {
+		if err := reader.BeginReading(); err != nil {
+			for _, opened := range merger.readers[:idx] {
+				opened.EndReading()
+			}
+			return err
+		}
+	}
+	for idx := range merger.readers {
+		if err := merger.push(idx); err != nil {
+			merger.EndReading()
+			return err
+		}
+	}
+	return nil
+}
+
+// Read the next record from a run into the queue. The priority's database
+// index is the run's position, which breaks ties between equal keys. We never
+// merge more than maxMergeRuns runs at once, so the position fits.
+func (merger *runMerger) push(idx int) error {
+	record, err := merger.readers[idx].ReadRecord()
+	if err != nil || record == nil {
+		return err
+	}
+	heap.Push(&merger.records, &Item{
+		record:   record,
+		reader:   merger.readers[idx],
+		priority: Priority{key: record.Key, databaseIndex: uint8(idx)},
+	})
+	return nil
+}
+
+func (merger *runMerger) ReadRecord() (*Record, error) {
+	if merger.records.Len() == 0 {
+		return nil, nil
+	}
+	item := heap.Pop(&merger.records).(*Item)
+	if err := merger.push(int(item.priority.databaseIndex)); err != nil {
+		return nil, err
+	}
+	return item.record, nil
+}
+
+func (merger *runMerger) EndReading() error {
+	var firstErr error
+	for _, reader := range merger.readers {
+		if err := reader.EndReading(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Prints records in the order it receives them.
+type printingWriter struct{}
+
+func (printingWriter) BeginWriting() error { return nil }
+func (printingWriter) EndWriting() error   { return nil }
+
+func (printingWriter) WriteRecord(record *Record) error {
+	fmt.Printf("%s: %s\n", record.Key, record.Value)
+	return nil
+}
+
+func ExampleSortingWriter() {
+	tempDir, err := ioutil.TempDir("", "transformer-sortingwriter-test")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// A tiny buffer makes the writer spill several runs to disk. Each value
+	// is the position of its record in the input.
+	writer := NewSortingWriter(printingWriter{}, tempDir, 4)
+	writer.BeginWriting()
+	for idx, key := range []string{"d", "b", "a", "c", "b", "a"} {
+		writer.WriteRecord(NewRecord(key, fmt.Sprint(idx), 0))
+	}
+	spilled, _ := ioutil.ReadDir(tempDir)
+	fmt.Println("Spilled:", len(spilled) > 0)
+	if err := writer.EndWriting(); err != nil {
+		panic(err)
+	}
+	remaining, _ := ioutil.ReadDir(tempDir)
+	fmt.Println("Remaining temporary files:", len(remaining))
+
+	// Output:
+	// Spilled: true
+	// a: 2
+	// a: 5
+	// b: 1
+	// b: 4
+	// c: 3
+	// d: 0
+	// Remaining temporary files: 0
+}
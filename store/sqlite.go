@@ -32,6 +32,10 @@ func NewSqliteStore(filename, table string, keyColumnNames, valueColumnNames []s
 	}
 }
 
+func (store *SqliteStore) Identity() string {
+	return fmt.Sprintf("sqlite:%s:%s", store.filename, store.table)
+}
+
 func (store *SqliteStore) BeginWriting() error {
 	db, err := sql.Open("sqlite3", store.filename)
 	if err != nil {
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"sync"
+)
+
+var temporaryLock sync.Mutex
+var temporaryIdentities = make(map[string]bool)
+
+type temporaryManager struct {
+	manager Manager
+}
+
+// Wrap manager so that the stores it creates are temporary. RunPipeline
+// deletes a temporary store once every stage that touches it has completed,
+// as long as at least one of those stages reads it. The stores must implement
+// Remover for this to work; LevelDB and slice stores do. For example:
+//
+//	scratch := store.NewTemporaryManager(store.NewLevelDbManager("/data/scratch"))
+//
+// Stores are temporary according to their Identity, so a store you create
+// directly with the same parameters (e.g., the path of a LevelDB) is also
+// temporary.
+func NewTemporaryManager(manager Manager) Manager {
+	return temporaryManager{manager}
+}
+
+// Report whether s is a store created by a Manager from NewTemporaryManager.
+func IsTemporary(s interface{}) bool {
+	temporaryLock.Lock()
+	defer temporaryLock.Unlock()
+	return temporaryIdentities[Identity(s)]
+}
+
+func markTemporary(s interface{}) {
+	temporaryLock.Lock()
+	defer temporaryLock.Unlock()
+	for _, identity := range Identities(s) {
+		temporaryIdentities[identity] = true
+	}
+}
+
+func (m temporaryManager) Reader(params ...interface{}) Reader {
+	s := m.manager.Reader(params...)
+	markTemporary(s)
+	return s
+}
+func (m temporaryManager) Writer(params ...interface{}) Writer {
+	s := m.manager.Writer(params...)
+	markTemporary(s)
+	return s
+}
+func (m temporaryManager) Seeker(params ...interface{}) Seeker {
+	s := m.manager.Seeker(params...)
+	markTemporary(s)
+	return s
+}
+func (m temporaryManager) Deleter(params ...interface{}) Deleter {
+	s := m.manager.Deleter(params...)
+	markTemporary(s)
+	return s
+}
+func (m temporaryManager) ReadingWriter(params ...interface{}) ReadingWriter {
+	s := m.manager.ReadingWriter(params...)
+	markTemporary(s)
+	return s
+}
+func (m temporaryManager) SeekingWriter(params ...interface{}) SeekingWriter {
+	s := m.manager.SeekingWriter(params...)
+	markTemporary(s)
+	return s
+}
+func (m temporaryManager) ReadingDeleter(params ...interface{}) ReadingDeleter {
+	s := m.manager.ReadingDeleter(params...)
+	markTemporary(s)
+	return s
+}
+func (m temporaryManager) SeekingDeleter(params ...interface{}) SeekingDeleter {
+	s := m.manager.SeekingDeleter(params...)
+	markTemporary(s)
+	return s
+}
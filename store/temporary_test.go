@@ -0,0 +1,18 @@
+package store
+
+import (
+	"fmt"
+)
+
+func ExampleNewTemporaryManager() {
+	manager := NewSliceManager()
+	temporary := NewTemporaryManager(manager)
+	fmt.Println(IsTemporary(temporary.Writer("scratch")))
+	fmt.Println(IsTemporary(manager.Reader("scratch")))
+	fmt.Println(IsTemporary(manager.Reader("final")))
+
+	// Output:
+	// true
+	// true
+	// false
+}
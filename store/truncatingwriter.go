@@ -9,6 +9,10 @@ func NewTruncatingWriter(writer Deleter) *TruncatingWriter {
 	return &TruncatingWriter{writer: writer}
 }
 
+func (store *TruncatingWriter) WrappedStores() []interface{} {
+	return []interface{}{store.writer}
+}
+
 func (store *TruncatingWriter) BeginWriting() error {
 	if err := store.writer.BeginWriting(); err != nil {
 		return err
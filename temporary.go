@@ -0,0 +1,79 @@
+package transformer
+
+import (
+	"log"
+
+	"github.com/sburnett/transformer/store"
+)
+
+// Keep temporary stores instead of deleting them once the stages that read
+// them complete. ParsePipelineChoice sets this from the -keep_temporary flag.
+var keepTemporaryStores = false
+
+type temporaryStore struct {
+	leaf    interface{}
+	stages  map[int]bool
+	read    bool
+	removed bool
+}
+
+// Find the temporary stores (see store.NewTemporaryManager) that the pipeline
+// reads or writes, keyed by store.Identity.
+func (pipeline Pipeline) temporaryStores() map[string]*temporaryStore {
+	temporaries := make(map[string]*temporaryStore)
+	add := func(idx int, s interface{}, read bool) {
+		for _, leaf := range store.Leaves(s) {
+			if !store.IsTemporary(leaf) {
+				continue
+			}
+			identity := store.Identity(leaf)
+			temporary, ok := temporaries[identity]
+			if !ok {
+				temporary = &temporaryStore{leaf: leaf, stages: make(map[int]bool)}
+				temporaries[identity] = temporary
+			}
+			temporary.stages[idx] = true
+			temporary.read = temporary.read || read
+		}
+	}
+	for idx, stage := range pipeline {
+		add(idx, stageInputs(stage), true)
+		add(idx, stage.Writer, false)
+	}
+	return temporaries
+}
+
+// Delete temporary stores once every stage that reads or writes them has
+// completed. We keep stores that no stage in the pipeline reads, since
+// they're presumably for a later run of the pipeline (e.g., with -run_only).
+// Failing to delete a store doesn't fail the pipeline.
+func removeTemporaryStores(temporaries map[string]*temporaryStore, completed []bool) {
+	if keepTemporaryStores {
+		return
+	}
+	for identity, temporary := range temporaries {
+		if temporary.removed || !temporary.read {
+			continue
+		}
+		done := true
+		for idx := range temporary.stages {
+			if !completed[idx] {
+				done = false
+				break
+			}
+		}
+		if !done {
+			continue
+		}
+		temporary.removed = true
+		remover, ok := temporary.leaf.(store.Remover)
+		if !ok {
+			log.Printf("Cannot delete temporary store %s: %T doesn't implement store.Remover", identity, temporary.leaf)
+			continue
+		}
+		log.Printf("Deleting temporary store %s", identity)
+		if err := remover.Remove(); err != nil {
+			log.Printf("Cannot delete temporary store %s: %v", identity, err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sburnett/transformer/store"
+)
+
+func ExamplePipeline_temporaryStores() {
+	dbRoot, err := ioutil.TempDir("", "transformer-temporary-test")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dbRoot)
+	manager := store.NewLevelDbManager(dbRoot)
+	scratch := store.NewTemporaryManager(manager)
+
+	input := manager.Writer("input")
+	input.BeginWriting()
+	input.WriteRecord(store.NewRecord("a", "x", 0))
+	input.EndWriting()
+
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dbRoot, name))
+		return err == nil
+	}
+	pipeline := Pipeline{
+		{
+			Name:   "WriteScratch",
+			Reader: manager.Reader("input"),
+			Writer: scratch.Writer("scratch"),
+		},
+		{
+			Name: "ReadScratch",
+			Transformer: TransformFunc(func(inputChan, outputChan chan *store.Record) {
+				fmt.Println("Scratch exists while reading:", exists("scratch"))
+				for record := range inputChan {
+					outputChan <- record
+				}
+			}),
+			Reader: scratch.Reader("scratch"),
+			Writer: manager.Writer("output"),
+		},
+	}
+	if err := RunPipelineContext(context.Background(), pipeline); err != nil {
+		panic(err)
+	}
+	fmt.Println("Scratch exists after pipeline:", exists("scratch"))
+	fmt.Println("Output exists after pipeline:", exists("output"))
+
+	// Output:
+	// Scratch exists while reading: true
+	// Scratch exists after pipeline: false
+	// Output exists after pipeline: true
+}
@@ -1,6 +1,8 @@
 package transformer
 
 import (
+	"context"
+
 	"github.com/sburnett/transformer/store"
 )
 
@@ -15,37 +17,57 @@ type Transformer interface {
 // transformer and write them to writer. Do not exit until all records have been
 // processed. Running transformers is a fundamental data processing operation,
 // but you should almost never run this function directly. Instead, use
-// RunPipeline to run a series of pipeline stages.
+// RunPipeline to run a series of pipeline stages. If writer is nil, we discard
+// the transformer's output.
+//
+// RunTransformer panics if reading or writing fails. Use TryRunTransformer to
+// handle those errors yourself.
 func RunTransformer(transformer Transformer, reader store.Reader, writer store.Writer) {
-	inputChan := make(chan *store.Record)
-	outputChan := make(chan *store.Record)
+	if err := TryRunTransformer(transformer, reader, writer); err != nil {
+		panic(err)
+	}
+}
 
+// Like RunTransformer, but return an error instead of panicking when the reader
+// or writer fails. When a store fails we stop reading new records and let the
+// transformer finish the records it has already received. If the reader
+// failed, we still write that output and end writing, so the writer keeps
+// whatever partial output the transformer produced. If the writer failed, we
+// discard the rest of the output. Either way, we end reading and writing on
+// both stores before returning. The returned error is a *StoreError describing
+// the failed operation, or the error that made the transformer give up (e.g.,
+// because of its DeadLetters option).
+func TryRunTransformer(transformer Transformer, reader store.Reader, writer store.Writer) error {
+	return RunTransformerContext(context.Background(), transformer, reader, writer)
+}
+
+// Like TryRunTransformer, but stop reading new records once ctx is done. We
+// still let the transformer finish the records it has already received and
+// write its output, then end reading and writing on both stores and return
+// ctx.Err().
+func RunTransformerContext(ctx context.Context, transformer Transformer, reader store.Reader, writer store.Writer) error {
+	return runTransformer(ctx, transformer, reader, writer, newStageStats())
+}
+
+func runTransformer(ctx context.Context, transformer Transformer, reader store.Reader, writer store.Writer, stats *stageStats) error {
+	inputChan := make(chan []*store.Record)
+	outputChan := make(chan []*store.Record)
+	abortChan := make(chan bool)
+
+	readerErrChan := make(chan error, 1)
 	if reader != nil {
 		go func() {
-			if err := reader.BeginReading(); err != nil {
-				panic(err)
-			}
-			for {
-				record, err := reader.ReadRecord()
-				if err != nil {
-					panic(err)
-				}
-				if record == nil {
-					break
-				}
-				inputChan <- record
-			}
-			if err := reader.EndReading(); err != nil {
-				panic(err)
-			}
-			close(inputChan)
+			readerErrChan <- readRecords(ctx, reader, inputChan, abortChan, stats)
 		}()
+	} else {
+		close(inputChan)
+		readerErrChan <- nil
 	}
 
 	transformerDone := make(chan bool)
 	if transformer != nil {
 		go func() {
-			transformer.Do(inputChan, outputChan)
+			doBatches(transformer, inputChan, outputChan)
 			close(outputChan)
 			transformerDone <- true
 		}()
@@ -56,19 +78,122 @@ func RunTransformer(transformer Transformer, reader store.Reader, writer store.W
 		}()
 	}
 
+	var writerErr error
 	if writer != nil {
-		if err := writer.BeginWriting(); err != nil {
-			panic(err)
-		}
-		for record := range outputChan {
-			if err := writer.WriteRecord(record); err != nil {
-				panic(err)
+		writerErr = writeRecords(writer, outputChan, stats)
+		if writerErr != nil {
+			close(abortChan)
+			for range outputChan {
 			}
 		}
-		if err := writer.EndWriting(); err != nil {
-			panic(err)
+	} else if transformer != nil {
+		for range outputChan {
 		}
 	}
 
 	<-transformerDone
+	if writerErr == nil {
+		// The transformer may have returned without reading all its input,
+		// so stop the reader rather than wait for someone to read the rest.
+		close(abortChan)
+	}
+	if readerErr := <-readerErrChan; readerErr != nil {
+		return readerErr
+	}
+	if err := transformerFailure(transformer); err != nil {
+		return err
+	}
+	if writerErr != nil {
+		return writerErr
+	}
+	// The reader may have finished before ctx was done, but we still report
+	// that the run was canceled.
+	return ctx.Err()
+}
+
+// Read every record from reader and send them in batches on inputChan, which
+// we close once we're done reading. Stop early if abortChan is closed or ctx
+// is done.
+func readRecords(ctx context.Context, reader store.Reader, inputChan chan []*store.Record, abortChan chan bool, stats *stageStats) error {
+	defer close(inputChan)
+	if err := reader.BeginReading(); err != nil {
+		return &StoreError{Op: "BeginReading", Store: reader, Err: err}
+	}
+	for ctx.Err() == nil {
+		var batch []*store.Record
+		var batchBytes int64
+		finished := false
+		for len(batch) < recordsPerBatch {
+			record, err := reader.ReadRecord()
+			if err != nil {
+				reader.EndReading()
+				return &StoreError{Op: "ReadRecord", Store: reader, Err: err}
+			}
+			if record == nil {
+				finished = true
+				break
+			}
+			batch = append(batch, record)
+			batchBytes += int64(len(record.Key) + len(record.Value))
+		}
+		if len(batch) > 0 {
+			select {
+			case inputChan <- batch:
+				stats.RecordsRead.Add(int64(len(batch)))
+				stats.BytesRead.Add(batchBytes)
+			case <-abortChan:
+				reader.EndReading()
+				return nil
+			case <-ctx.Done():
+				continue
+			}
+		}
+		if finished {
+			return endReading(reader, nil)
+		}
+	}
+	return endReading(reader, ctx.Err())
+}
+
+// End reading from reader, returning err unless EndReading itself fails.
+func endReading(reader store.Reader, err error) error {
+	if endErr := reader.EndReading(); endErr != nil {
+		return &StoreError{Op: "EndReading", Store: reader, Err: endErr}
+	}
+	return err
+}
+
+// Write every batch of records from outputChan to writer, using WriteRecords
+// if writer is a store.BatchWriter. If writing fails, we end writing and
+// return immediately without draining outputChan.
+func writeRecords(writer store.Writer, outputChan chan []*store.Record, stats *stageStats) error {
+	if err := writer.BeginWriting(); err != nil {
+		return &StoreError{Op: "BeginWriting", Store: writer, Err: err}
+	}
+	batchWriter, isBatchWriter := writer.(store.BatchWriter)
+	for batch := range outputChan {
+		if isBatchWriter {
+			if err := batchWriter.WriteRecords(batch); err != nil {
+				writer.EndWriting()
+				return &StoreError{Op: "WriteRecords", Store: writer, Err: err}
+			}
+		} else {
+			for _, record := range batch {
+				if err := writer.WriteRecord(record); err != nil {
+					writer.EndWriting()
+					return &StoreError{Op: "WriteRecord", Store: writer, Err: err}
+				}
+			}
+		}
+		var batchBytes int64
+		for _, record := range batch {
+			batchBytes += int64(len(record.Key) + len(record.Value))
+		}
+		stats.RecordsWritten.Add(int64(len(batch)))
+		stats.BytesWritten.Add(batchBytes)
+	}
+	if err := writer.EndWriting(); err != nil {
+		return &StoreError{Op: "EndWriting", Store: writer, Err: err}
+	}
+	return nil
 }
@@ -0,0 +1,127 @@
+package transformer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sburnett/transformer/store"
+)
+
+type failingWriter struct {
+	store.SliceStore
+	failAfter int
+}
+
+func (writer *failingWriter) WriteRecord(record *store.Record) error {
+	if writer.failAfter == 0 {
+		return errors.New("disk full")
+	}
+	writer.failAfter--
+	return writer.SliceStore.WriteRecord(record)
+}
+
+func ExampleTryRunTransformer() {
+	reader := store.SliceStore{}
+	reader.BeginWriting()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		reader.WriteRecord(store.NewRecord(key, "x", 0))
+	}
+	reader.EndWriting()
+
+	writer := &failingWriter{failAfter: 2}
+	err := TryRunTransformer(MakeMapFunc(func(record *store.Record) *store.Record {
+		return record
+	}), &reader, writer)
+	fmt.Println(err)
+
+	// Output:
+	// WriteRecord on *transformer.failingWriter: disk full
+}
+
+func ExampleTryRunTransformer_returnEarly() {
+	// More records than fit in a batch.
+	reader := &store.SliceStore{}
+	reader.BeginWriting()
+	for i := 0; i < 5000; i++ {
+		reader.WriteRecord(store.NewRecord(fmt.Sprintf("%04d", i), "x", 0))
+	}
+	reader.EndWriting()
+
+	// Transformers may return without reading all their input.
+	err := TryRunTransformer(TransformFunc(func(inputChan, outputChan chan *store.Record) {
+		record := <-inputChan
+		fmt.Printf("Read %s\n", record.Key)
+	}), reader, &store.SliceStore{})
+	fmt.Println(err)
+
+	// So may stages that don't transform or write their input.
+	err = TryRunPipeline(Pipeline{{Name: "ReadOnly", Reader: reader}})
+	fmt.Println(err)
+
+	// Output:
+	// Read 0000
+	// <nil>
+	// <nil>
+}
+
+func ExampleTryRunPipeline() {
+	writer := &failingWriter{}
+	err := TryRunPipeline(Pipeline{
+		{
+			Name: "WriteOne",
+			Transformer: TransformFunc(func(inputChan, outputChan chan *store.Record) {
+				outputChan <- store.NewRecord("a", "b", 0)
+			}),
+			Writer: writer,
+		},
+	})
+	fmt.Println(err)
+
+	// Output:
+	// stage WriteOne: WriteRecord on *transformer.failingWriter: disk full
+}
+
+func ExampleRunTransformerContext() {
+	reader := store.SliceStore{}
+	reader.BeginWriting()
+	for _, key := range []string{"a", "b", "c"} {
+		reader.WriteRecord(store.NewRecord(key, "x", 0))
+	}
+	reader.EndWriting()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	writer := store.SliceStore{}
+	err := RunTransformerContext(ctx, MakeMapFunc(func(record *store.Record) *store.Record {
+		return record
+	}), &reader, &writer)
+	fmt.Println(err)
+
+	// Output:
+	// context canceled
+}
+
+func ExampleRunTransformerContext_canceledAfterReading() {
+	reader := store.SliceStore{}
+	reader.BeginWriting()
+	for _, key := range []string{"a", "b", "c"} {
+		reader.WriteRecord(store.NewRecord(key, "x", 0))
+	}
+	reader.EndWriting()
+
+	// The transformer reads every record before we cancel, so only the
+	// final check of ctx notices.
+	ctx, cancel := context.WithCancel(context.Background())
+	writer := store.SliceStore{}
+	err := RunTransformerContext(ctx, TransformFunc(func(inputChan, outputChan chan *store.Record) {
+		for record := range inputChan {
+			outputChan <- record
+		}
+		cancel()
+	}), &reader, &writer)
+	fmt.Println(err)
+
+	// Output:
+	// context canceled
+}
@@ -3,7 +3,6 @@ package transformer
 import (
 	"bytes"
 	"flag"
-	"fmt"
 	"runtime"
 
 	"github.com/sburnett/transformer/store"
@@ -22,7 +21,7 @@ func maxParallelism() int {
 
 func init() {
 	cores := maxParallelism()
-	flag.IntVar(&workers, "workers", 2*cores, "Number of worker threads for mappers.")
+	flag.IntVar(&workers, "workers", 2*cores, "Default number of worker threads for transformers that don't set the Workers option.")
 }
 
 // Restricts the maximum number of concurrent workers to one, which forces
@@ -84,37 +83,104 @@ type MultipleOutputsGroupDoer interface {
 	GroupDoToMultipleOutputs(inputRecords []*store.Record, outputChans ...chan *store.Record)
 }
 
+type mapTransformer struct {
+	mapper  Mapper
+	options transformerOptions
+}
+
+type doTransformer struct {
+	doer    Doer
+	options transformerOptions
+}
+
+type groupDoTransformer struct {
+	doer    GroupDoer
+	options transformerOptions
+}
+
 // Turn a Mapper into a Transformer.
-func MakeMapTransformer(mapper Mapper) Transformer {
-	doFunc := func(inputRecord *store.Record, outputChan chan *store.Record) {
-		outputChan <- mapper.Map(inputRecord)
-	}
-	return MakeDoFunc(doFunc)
+func MakeMapTransformer(mapper Mapper, options ...Option) Transformer {
+	return mapTransformer{mapper, makeOptions(options)}
 }
 
-// Turn a Doer into a Transformer.
-func MakeDoTransformer(doer Doer) Transformer {
-	if !flag.Parsed() {
-		panic(fmt.Errorf("flags must be parsed"))
-	}
-	return TransformFunc(func(inputChan, outputChan chan *store.Record) {
-		doneChan := make(chan bool)
-		for i := 0; i < workers; i++ {
-			go func() {
-				for record := range inputChan {
-					doer.Do(record, outputChan)
-				}
-				doneChan <- true
-			}()
+func (transformer mapTransformer) Do(inputChan, outputChan chan *store.Record) {
+	doFunc := DoFunc(func(inputRecord *store.Record, outputChan chan *store.Record) {
+		if outputRecord := transformer.mapper.Map(inputRecord); outputRecord != nil {
+			outputChan <- outputRecord
 		}
-		for i := 0; i < workers; i++ {
-			<-doneChan
+	})
+	doTransformer{doFunc, transformer.options}.Do(inputChan, outputChan)
+}
+
+func (transformer mapTransformer) failure() error {
+	return transformer.options.deadLetters.failure()
+}
+
+func (transformer mapTransformer) DoBatches(inputChan, outputChan chan []*store.Record) {
+	deadLetters := transformer.options.deadLetters
+	deadLetters.begin()
+	defer deadLetters.end()
+	processBatches(transformer.options.bufferBatches(inputChan), outputChan, transformer.options.numWorkers(), func(inputRecords []*store.Record) []*store.Record {
+		var outputRecords []*store.Record
+		for _, inputRecord := range inputRecords {
+			deadLetters.protect([]*store.Record{inputRecord}, func() {
+				if outputRecord := transformer.mapper.Map(inputRecord); outputRecord != nil {
+					outputRecords = append(outputRecords, outputRecord)
+				}
+			})
 		}
+		return outputRecords
+	})
+}
+
+// Turn a Doer into a Transformer.
+func MakeDoTransformer(doer Doer, options ...Option) Transformer {
+	return doTransformer{doer, makeOptions(options)}
+}
+
+func (transformer doTransformer) Do(inputChan, outputChan chan *store.Record) {
+	deadLetters := transformer.options.deadLetters
+	deadLetters.begin()
+	defer deadLetters.end()
+	workers := transformer.options.numWorkers()
+	inputChan = transformer.options.bufferRecords(inputChan)
+	doneChan := make(chan bool)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for record := range inputChan {
+				deadLetters.protect([]*store.Record{record}, func() {
+					transformer.doer.Do(record, outputChan)
+				})
+			}
+			doneChan <- true
+		}()
+	}
+	for i := 0; i < workers; i++ {
+		<-doneChan
+	}
+}
+
+func (transformer doTransformer) failure() error {
+	return transformer.options.deadLetters.failure()
+}
+
+func (transformer doTransformer) DoBatches(inputChan, outputChan chan []*store.Record) {
+	deadLetters := transformer.options.deadLetters
+	deadLetters.begin()
+	defer deadLetters.end()
+	processBatches(transformer.options.bufferBatches(inputChan), outputChan, transformer.options.numWorkers(), func(inputRecords []*store.Record) []*store.Record {
+		return collectRecords(func(recordsChan chan *store.Record) {
+			for _, inputRecord := range inputRecords {
+				deadLetters.protect([]*store.Record{inputRecord}, func() {
+					transformer.doer.Do(inputRecord, recordsChan)
+				})
+			}
+		})
 	})
 }
 
 // Turn a MultpleOutputsDoer into a Transformer.
-func MakeMultipleOutputsDoTransformer(doer MultipleOutputsDoer, numOutputs int) Transformer {
+func MakeMultipleOutputsDoTransformer(doer MultipleOutputsDoer, numOutputs int, options ...Option) Transformer {
 	doFunc := func(inputRecord *store.Record, outputChan chan *store.Record) {
 		outputChans := make([]chan *store.Record, numOutputs, numOutputs)
 		doneChan := make(chan bool)
@@ -130,58 +196,129 @@ func MakeMultipleOutputsDoTransformer(doer MultipleOutputsDoer, numOutputs int)
 				doneChan <- true
 			}(i)
 		}
+		// Stop the goroutines even if the doer panics.
+		defer func() {
+			for _, outputChan := range outputChans {
+				close(outputChan)
+			}
+			for i := 0; i < numOutputs; i++ {
+				<-doneChan
+			}
+		}()
 		doer.DoToMultipleOutputs(inputRecord, outputChans...)
-		for _, outputChan := range outputChans {
-			close(outputChan)
-		}
-		for i := 0; i < numOutputs; i++ {
-			<-doneChan
-		}
 	}
-	return MakeDoFunc(doFunc)
+	return MakeDoFunc(doFunc, options...)
 }
 
 // Turn a GroupDoer into a Transformer.
-func MakeGroupDoTransformer(doer GroupDoer) Transformer {
-	if !flag.Parsed() {
-		panic(fmt.Errorf("flags must be parsed"))
+func MakeGroupDoTransformer(doer GroupDoer, options ...Option) Transformer {
+	return groupDoTransformer{doer, makeOptions(options)}
+}
+
+func (transformer groupDoTransformer) Do(inputChan, outputChan chan *store.Record) {
+	deadLetters := transformer.options.deadLetters
+	deadLetters.begin()
+	defer deadLetters.end()
+	workers := transformer.options.numWorkers()
+	inputChan = transformer.options.bufferRecords(inputChan)
+	doneChan := make(chan bool)
+	groupedInputsChan := make(chan []*store.Record)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for records := range groupedInputsChan {
+				deadLetters.protect(records, func() {
+					transformer.doer.GroupDo(records, outputChan)
+				})
+			}
+			doneChan <- true
+		}()
 	}
-	return TransformFunc(func(inputChan, outputChan chan *store.Record) {
-		doneChan := make(chan bool)
-		groupedInputsChan := make(chan []*store.Record)
-		for i := 0; i < workers; i++ {
-			go func() {
-				for record := range groupedInputsChan {
-					doer.GroupDo(record, outputChan)
-				}
-				doneChan <- true
-			}()
+	var currentKey []byte
+	var currentRecords []*store.Record
+	for record := range inputChan {
+		if currentKey == nil {
+			currentKey = record.Key
 		}
-		var currentKey []byte
-		var currentRecords []*store.Record
-		for record := range inputChan {
-			if currentKey == nil {
-				currentKey = record.Key
+		if !bytes.Equal(currentKey, record.Key) {
+			groupedInputsChan <- currentRecords
+			currentKey = record.Key
+			currentRecords = nil
+		}
+		currentRecords = append(currentRecords, record)
+	}
+	if currentRecords != nil {
+		groupedInputsChan <- currentRecords
+	}
+	close(groupedInputsChan)
+	for i := 0; i < workers; i++ {
+		<-doneChan
+	}
+}
+
+func (transformer groupDoTransformer) failure() error {
+	return transformer.options.deadLetters.failure()
+}
+
+// Split batches of records into groups with identical keys and send batches
+// of groups to the workers. A group can span several input batches, but we
+// never split a group across workers.
+func (transformer groupDoTransformer) DoBatches(inputChan, outputChan chan []*store.Record) {
+	deadLetters := transformer.options.deadLetters
+	deadLetters.begin()
+	defer deadLetters.end()
+	workers := transformer.options.numWorkers()
+	inputChan = transformer.options.bufferBatches(inputChan)
+	groupBatchesChan := make(chan [][]*store.Record)
+	doneChan := make(chan bool)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for groups := range groupBatchesChan {
+				outputRecords := collectRecords(func(recordsChan chan *store.Record) {
+					for _, group := range groups {
+						deadLetters.protect(group, func() {
+							transformer.doer.GroupDo(group, recordsChan)
+						})
+					}
+				})
+				if len(outputRecords) > 0 {
+					outputChan <- outputRecords
+				}
 			}
-			if !bytes.Equal(currentKey, record.Key) {
-				groupedInputsChan <- currentRecords
-				currentKey = record.Key
+			doneChan <- true
+		}()
+	}
+	var groups [][]*store.Record
+	var groupedRecords int
+	var currentRecords []*store.Record
+	for batch := range inputChan {
+		for _, record := range batch {
+			if currentRecords != nil && !bytes.Equal(currentRecords[0].Key, record.Key) {
+				groups = append(groups, currentRecords)
+				groupedRecords += len(currentRecords)
 				currentRecords = nil
+				if groupedRecords >= recordsPerBatch {
+					groupBatchesChan <- groups
+					groups = nil
+					groupedRecords = 0
+				}
 			}
 			currentRecords = append(currentRecords, record)
 		}
-		if currentRecords != nil {
-			groupedInputsChan <- currentRecords
-		}
-		close(groupedInputsChan)
-		for i := 0; i < workers; i++ {
-			<-doneChan
-		}
-	})
+	}
+	if currentRecords != nil {
+		groups = append(groups, currentRecords)
+	}
+	if len(groups) > 0 {
+		groupBatchesChan <- groups
+	}
+	close(groupBatchesChan)
+	for i := 0; i < workers; i++ {
+		<-doneChan
+	}
 }
 
 // Turn a MultipleOutputsGroupDoer into a Transformer.
-func MakeMultipleOutputsGroupDoTransformer(doer MultipleOutputsGroupDoer, numOutputs int) Transformer {
+func MakeMultipleOutputsGroupDoTransformer(doer MultipleOutputsGroupDoer, numOutputs int, options ...Option) Transformer {
 	groupDoFunc := func(inputRecords []*store.Record, outputChan chan *store.Record) {
 		outputChans := make([]chan *store.Record, numOutputs, numOutputs)
 		doneChan := make(chan bool)
@@ -195,15 +332,18 @@ func MakeMultipleOutputsGroupDoTransformer(doer MultipleOutputsGroupDoer, numOut
 				doneChan <- true
 			}(idx)
 		}
+		// Stop the goroutines even if the doer panics.
+		defer func() {
+			for _, outputChan := range outputChans {
+				close(outputChan)
+			}
+			for i := 0; i < numOutputs; i++ {
+				<-doneChan
+			}
+		}()
 		doer.GroupDoToMultipleOutputs(inputRecords, outputChans...)
-		for _, outputChan := range outputChans {
-			close(outputChan)
-		}
-		for i := 0; i < numOutputs; i++ {
-			<-doneChan
-		}
 	}
-	return MakeGroupDoFunc(groupDoFunc)
+	return MakeGroupDoFunc(groupDoFunc, options...)
 }
 
 type TransformFunc func(inputChan, outputChan chan *store.Record)
@@ -243,26 +383,26 @@ func (multipleOutputsGroupDoFunc MultipleOutputsGroupDoFunc) GroupDoToMultipleOu
 }
 
 // Turn a MapFunc into a Transformer.
-func MakeMapFunc(mapperFunc MapFunc) Transformer {
-	return MakeMapTransformer(MapFunc(mapperFunc))
+func MakeMapFunc(mapperFunc MapFunc, options ...Option) Transformer {
+	return MakeMapTransformer(MapFunc(mapperFunc), options...)
 }
 
 // Turn a DoFunc into a Transformer.
-func MakeDoFunc(doFunc DoFunc) Transformer {
-	return MakeDoTransformer(DoFunc(doFunc))
+func MakeDoFunc(doFunc DoFunc, options ...Option) Transformer {
+	return MakeDoTransformer(DoFunc(doFunc), options...)
 }
 
 // Turn a MultipleOutputsDoFunc into a Transformer.
-func MakeMultipleOutputsDoFunc(multiDoFunc MultipleOutputsDoFunc, numOutputs int) Transformer {
-	return MakeMultipleOutputsDoTransformer(MultipleOutputsDoFunc(multiDoFunc), numOutputs)
+func MakeMultipleOutputsDoFunc(multiDoFunc MultipleOutputsDoFunc, numOutputs int, options ...Option) Transformer {
+	return MakeMultipleOutputsDoTransformer(MultipleOutputsDoFunc(multiDoFunc), numOutputs, options...)
 }
 
 // Turn GroupDoFunc into a Transformer.
-func MakeGroupDoFunc(doFunc GroupDoFunc) Transformer {
-	return MakeGroupDoTransformer(GroupDoFunc(doFunc))
+func MakeGroupDoFunc(doFunc GroupDoFunc, options ...Option) Transformer {
+	return MakeGroupDoTransformer(GroupDoFunc(doFunc), options...)
 }
 
 // Turn a MultipleOutputsGroupDoFunc into a Transformer.
-func MakeMultipleOutputsGroupDoFunc(multiGroupDoFunc MultipleOutputsGroupDoFunc, numOutputs int) Transformer {
-	return MakeMultipleOutputsGroupDoTransformer(MultipleOutputsGroupDoFunc(multiGroupDoFunc), numOutputs)
+func MakeMultipleOutputsGroupDoFunc(multiGroupDoFunc MultipleOutputsGroupDoFunc, numOutputs int, options ...Option) Transformer {
+	return MakeMultipleOutputsGroupDoTransformer(MultipleOutputsGroupDoFunc(multiGroupDoFunc), numOutputs, options...)
 }